@@ -0,0 +1,121 @@
+package repr
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// Normalize returns a deep copy of v normalized according to options, such that printing the copy
+// with the same options gives the same output as printing v.
+//
+// Slices and arrays are sorted as they would be printed, fields and map entries excluded from output
+// are zeroed or removed. Values with registered constructors or renderers are copied shallowly.
+// Pointers, maps and slices that are shared, or part of a cycle, in v are shared in the copy too.
+//
+// Combined with Canonical, this produces a canonical form of v suitable for programmatic comparison.
+func Normalize(v any, options ...Option) any {
+	c := &cloner{p: New(nil, options...), seen: map[cloneKey]reflect.Value{}, path: map[reflect.Value]bool{}}
+	out := c.clone(reflect.ValueOf(v))
+	if !out.IsValid() {
+		return nil
+	}
+	return out.Interface()
+}
+
+type cloneKey struct {
+	ptr uintptr
+	typ reflect.Type
+	len int // Length of slices, which can share their first element with shorter slices.
+}
+
+type cloner struct {
+	p    *Printer
+	seen map[cloneKey]reflect.Value
+	// Values on the current path, for cycle detection while ordering slices.
+	path map[reflect.Value]bool
+}
+
+// Returns a deep copy of v. Unexported fields are copied via unsafe.
+func (c *cloner) clone(v reflect.Value) reflect.Value {
+	if !v.IsValid() {
+		return v
+	}
+	t := v.Type()
+	out := reflect.New(t).Elem()
+	if isNil(v) {
+		return out
+	}
+	if t == timeType || constructor(v) != nil || namedRenderer(t) != nil {
+		out.Set(v)
+		return out
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		key := cloneKey{v.Pointer(), t, 0}
+		if ptr, ok := c.seen[key]; ok {
+			return ptr
+		}
+		ptr := reflect.New(t.Elem())
+		c.seen[key] = ptr
+		c.path[v.Elem()] = true
+		ptr.Elem().Set(c.clone(v.Elem()))
+		delete(c.path, v.Elem())
+		out.Set(ptr)
+
+	case reflect.Interface:
+		out.Set(c.clone(v.Elem()))
+
+	case reflect.Struct:
+		if !v.CanAddr() {
+			// Fields of unaddressable structs can't be accessed via unsafe, so copy it first.
+			src := reflect.New(t).Elem()
+			src.Set(v)
+			v = src
+		}
+		plan := planOf(t)
+		for i := 0; i < v.NumField(); i++ {
+			f := accessible(v.Field(i))
+			if c.p.hideField(&plan.fields[i], f) {
+				continue
+			}
+			settable(out.Field(i)).Set(c.clone(f))
+		}
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice {
+			key := cloneKey{v.Pointer(), t, v.Len()}
+			if slice, ok := c.seen[key]; ok {
+				return slice
+			}
+			// Elements set below are visible through the copy, as it shares its backing array.
+			out = reflect.MakeSlice(t, v.Len(), v.Len())
+			c.seen[key] = out
+		}
+		for i, j := range c.p.sliceOrder(c.path, v) {
+			out.Index(i).Set(c.clone(v.Index(j)))
+		}
+
+	case reflect.Map:
+		key := cloneKey{v.Pointer(), t, 0}
+		if m, ok := c.seen[key]; ok {
+			return m
+		}
+		out = reflect.MakeMapWithSize(t, v.Len())
+		c.seen[key] = out
+		for _, k := range c.p.withoutOmitted(v, v.MapKeys()) {
+			out.SetMapIndex(c.clone(k), c.clone(v.MapIndex(k)))
+		}
+
+	default:
+		out.Set(v)
+	}
+	return out
+}
+
+// Returns a settable version of an addressable, possibly unexported, value.
+func settable(v reflect.Value) reflect.Value {
+	if v.CanSet() {
+		return v
+	}
+	return reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem()
+}
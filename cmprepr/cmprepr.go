@@ -0,0 +1,79 @@
+// Package cmprepr provides a go-cmp Reporter that renders differing values with repr.
+//
+// It lives in its own module so that repr itself does not depend on go-cmp.
+package cmprepr
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/alecthomas/repr"
+)
+
+// Reporter collects the differences found by cmp.Equal, rendering each pair of differing values
+// with repr.
+//
+//	r := cmprepr.New()
+//	if !cmp.Equal(want, have, r.Option()) {
+//		t.Errorf("mismatch:\n%s", r)
+//	}
+//
+// A Reporter may be reused; each call to cmp.Equal appends to the report.
+type Reporter struct {
+	options []repr.Option
+	path    cmp.Path
+	diffs   []string
+}
+
+// New creates a Reporter that renders values with the given repr options.
+func New(options ...repr.Option) *Reporter {
+	return &Reporter{options: options}
+}
+
+// Option returns the cmp.Option that installs r as the reporter for cmp.Equal.
+func (r *Reporter) Option() cmp.Option {
+	return cmp.Reporter(r)
+}
+
+// PushStep implements the go-cmp reporter interface.
+func (r *Reporter) PushStep(ps cmp.PathStep) {
+	r.path = append(r.path, ps)
+}
+
+// PopStep implements the go-cmp reporter interface.
+func (r *Reporter) PopStep() {
+	r.path = r.path[:len(r.path)-1]
+}
+
+// Report implements the go-cmp reporter interface.
+func (r *Reporter) Report(rs cmp.Result) {
+	if rs.Equal() {
+		return
+	}
+	vx, vy := r.path.Last().Values()
+	r.diffs = append(r.diffs, fmt.Sprintf("%#v:\n\t-: %s\n\t+: %s\n", r.path, r.repr(vx), r.repr(vy)))
+}
+
+// Diffs returns each difference found so far, one per differing path.
+func (r *Reporter) Diffs() []string {
+	return r.diffs
+}
+
+// String returns all differences found so far.
+func (r *Reporter) String() string {
+	return strings.Join(r.diffs, "")
+}
+
+func (r *Reporter) repr(v reflect.Value) string {
+	if !v.IsValid() {
+		// Eg. a map key only present on one side.
+		return "<missing>"
+	}
+	if !v.CanInterface() {
+		return fmt.Sprintf("%v", v)
+	}
+	return strings.ReplaceAll(repr.String(v.Interface(), r.options...), "\n", "\n\t   ")
+}
@@ -0,0 +1,54 @@
+package cmprepr
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/alecthomas/repr"
+)
+
+type user struct {
+	Name  string
+	Tags  []string
+	Attrs map[string]int
+}
+
+func TestReporter(t *testing.T) {
+	want := user{Name: "alice", Tags: []string{"a"}, Attrs: map[string]int{"age": 30, "id": 1}}
+	have := user{Name: "bob", Tags: []string{"a"}, Attrs: map[string]int{"age": 31}}
+	r := New(repr.OmitEmpty(false))
+	if cmp.Equal(want, have, r.Option()) {
+		t.Fatal("expected values to differ")
+	}
+	expected := `{cmprepr.user}.Name:
+	-: "alice"
+	+: "bob"
+{cmprepr.user}.Attrs["age"]:
+	-: 30
+	+: 31
+{cmprepr.user}.Attrs["id"]:
+	-: 1
+	+: <missing>
+`
+	if r.String() != expected {
+		t.Errorf("\nWant: %q\nHave: %q", expected, r.String())
+	}
+	if len(r.Diffs()) != 3 {
+		t.Errorf("expected 3 diffs, got %d", len(r.Diffs()))
+	}
+}
+
+func TestReporterMultiline(t *testing.T) {
+	r := New(repr.Indent("  "))
+	cmp.Equal([]user{{Name: "a"}}, []user{{Name: "a", Tags: []string{"x"}}}, r.Option())
+	expected := `{[]cmprepr.user}[0].Tags:
+	-: nil
+	+: []string{
+	     "x",
+	   }
+`
+	if r.String() != expected {
+		t.Errorf("\nWant: %q\nHave: %q", expected, r.String())
+	}
+}
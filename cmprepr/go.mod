@@ -0,0 +1,8 @@
+module github.com/alecthomas/repr/cmprepr
+
+go 1.18
+
+require (
+	github.com/alecthomas/repr v0.0.0-20261015140834-5516c75cd376
+	github.com/google/go-cmp v0.6.0
+)
@@ -0,0 +1,554 @@
+package repr
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Packages that may be referenced by generated expressions without appearing in the types of a value.
+var implicitImports = map[string]string{"math": "math", "time": "time"}
+
+// Var is a named value to declare in a generated Go file.
+type Var struct {
+	Name  string
+	Value any
+}
+
+// GoFile returns a gofmt-ed Go source file in package pkg, declaring a variable called name
+// initialised to v.
+//
+// v is represented in StrictGo mode, and the packages of all types referenced are imported. Types
+// in a package named pkg are taken to be in the generated package, so are not qualified.
+func GoFile(pkg, name string, v any, options ...Option) ([]byte, error) {
+	return GoVars(pkg, []Var{{Name: name, Value: v}}, options...)
+}
+
+// GoVars is like GoFile, but declares a variable for each of vars, with a single import block
+// shared between them.
+func GoVars(pkg string, vars []Var, options ...Option) ([]byte, error) {
+	w := &bytes.Buffer{}
+	options = append([]Option{StrictGo(), Indent("\t")}, options...)
+	// Colour would make the output invalid Go.
+	p := New(w, append(options, NoColor())...)
+	imports := newImportSet(pkg)
+	p.onType = imports.collect
+	p.imports = imports
+	p.localPkg = pkg
+	if p.internStrings > 0 || p.dedupSubtrees > 0 {
+		// Count literals in a first pass, so that only repeated ones are hoisted in the second.
+		p.hoist = newHoister(p, vars)
+		for _, v := range vars {
+			p.Print(v.Value)
+		}
+		p.hoist.counting = false
+	}
+	exprs := make([]string, len(vars))
+	for i, v := range vars {
+		w.Reset()
+		p.Print(v.Value)
+		exprs[i] = unqualify(w.String(), pkg)
+	}
+	if p.hoist != nil {
+		for _, decls := range [][]Var{p.hoist.consts, p.hoist.vars} {
+			for i := range decls {
+				decls[i].Value = unqualify(decls[i].Value.(string), pkg)
+			}
+		}
+	}
+
+	out := &bytes.Buffer{}
+	if p.buildConstraint != "" {
+		fmt.Fprintf(out, "//go:build %s\n\n", p.buildConstraint)
+	}
+	if p.provenance {
+		writeProvenance(out, vars, options)
+	}
+	fmt.Fprintf(out, "package %s\n\n", pkg)
+	if p.hoist != nil {
+		writeImports(out, append(exprs, p.hoist.exprs()...), pkg, imports)
+		p.hoist.writeDecls(out)
+	} else {
+		writeImports(out, exprs, pkg, imports)
+	}
+	var consts, vs []int
+	for i, v := range vars {
+		if p.consts && isConstant(reflect.ValueOf(v.Value)) {
+			consts = append(consts, i)
+		} else {
+			vs = append(vs, i)
+		}
+	}
+	writeDecls(out, "const", vars, exprs, consts, true)
+	writeDecls(out, "var", vars, exprs, vs, true)
+	source, err := format.Source(out.Bytes())
+	if err != nil {
+		return out.Bytes(), fmt.Errorf("repr: generated invalid Go source: %w", err)
+	}
+	return source, nil
+}
+
+// Tracks values that are hoisted out of generated expressions into their own declarations.
+type hoister struct {
+	p        *Printer
+	counting bool
+	counts   map[string]int
+	names    map[string]string
+	reserved map[string]bool
+	consts   []Var
+	vars     []Var
+	// Representation of the subtree currently being declared, which must not refer to itself.
+	declaring string
+}
+
+func newHoister(p *Printer, vars []Var) *hoister {
+	h := &hoister{p: p, counting: true, counts: map[string]int{}, names: map[string]string{}, reserved: map[string]bool{}}
+	for _, v := range vars {
+		h.reserved[v.Name] = true
+	}
+	return h
+}
+
+// Returns the name of the constant to use for the quoted string literal, or the literal itself.
+func (h *hoister) internString(literal string) string {
+	if h.p.internStrings == 0 || len(literal)-2 < h.p.internStrings {
+		return literal
+	}
+	if h.counting {
+		h.counts[literal]++
+		return literal
+	}
+	if h.counts[literal] < 2 {
+		return literal
+	}
+	if name, ok := h.names[literal]; ok {
+		return name
+	}
+	name := h.name("str")
+	h.names[literal] = name
+	h.consts = append(h.consts, Var{Name: name, Value: literal})
+	return name
+}
+
+// Returns the name of the variable to use for the composite value v, if it is to be hoisted.
+func (h *hoister) subtree(seen map[reflect.Value]bool, path string, v reflect.Value) (string, bool) {
+	// v is already being printed, so must be removed from seen to be printed again.
+	delete(seen, v)
+	defer func() { seen[v] = true }()
+	key := h.p.flatString(seen, v)
+	if len(key) < h.p.dedupSubtrees {
+		return "", false
+	}
+	if h.counting {
+		h.counts[key]++
+		return "", false
+	}
+	if h.counts[key] < 2 || key == h.declaring {
+		return "", false
+	}
+	if name, ok := h.names[key]; ok {
+		return name, true
+	}
+	name := h.name("shared")
+	h.names[key] = name
+	w := &strings.Builder{}
+	decl := *h.p
+	decl.w = w
+	declaring := h.declaring
+	h.declaring = key
+	decl.reprValue(seen, path, v, "", true, false)
+	h.declaring = declaring
+	h.vars = append(h.vars, Var{Name: name, Value: w.String()})
+	return name, true
+}
+
+// Returns an unused name with the given prefix.
+func (h *hoister) name(prefix string) string {
+	for i := len(h.names) + 1; ; i++ {
+		name := fmt.Sprintf("%s%d", prefix, i)
+		if !h.reserved[name] {
+			h.reserved[name] = true
+			return name
+		}
+	}
+}
+
+// Returns the expressions of all hoisted declarations.
+func (h *hoister) exprs() []string {
+	exprs := []string{}
+	for _, v := range append(h.consts, h.vars...) {
+		exprs = append(exprs, v.Value.(string))
+	}
+	return exprs
+}
+
+func (h *hoister) writeDecls(w *bytes.Buffer) {
+	for _, decls := range []struct {
+		keyword string
+		vars    []Var
+	}{{"const", h.consts}, {"var", h.vars}} {
+		if len(decls.vars) == 0 {
+			continue
+		}
+		exprs := make([]string, len(decls.vars))
+		indexes := make([]int, len(decls.vars))
+		for i, v := range decls.vars {
+			exprs[i] = v.Value.(string)
+			indexes[i] = i
+		}
+		writeDecls(w, decls.keyword, decls.vars, exprs, indexes, false)
+		fmt.Fprintln(w)
+	}
+}
+
+// Writes a declaration of each of vars[indexes] with the given keyword. If typed, the types of vars
+// are declared where their expressions would otherwise have a different type.
+func writeDecls(w *bytes.Buffer, keyword string, vars []Var, exprs []string, indexes []int, typed bool) {
+	decl := func(i int) string {
+		name := vars[i].Name
+		if t := declType(vars[i].Value, exprs[i]); typed && t != "" {
+			name += " " + t
+		}
+		return name + " = " + exprs[i]
+	}
+	switch len(indexes) {
+	case 0:
+	case 1:
+		fmt.Fprintf(w, "%s %s\n", keyword, decl(indexes[0]))
+	default:
+		fmt.Fprintf(w, "%s (\n", keyword)
+		for _, i := range indexes {
+			fmt.Fprintln(w, decl(i))
+		}
+		fmt.Fprintln(w, ")")
+	}
+}
+
+// Returns the type to declare for top-level value v, represented by expr, if expr is an untyped
+// constant whose default type is not the type of v, eg. "int64" for int64(7), which is represented
+// as 7. Values of named types are represented with a conversion, so never need a declared type.
+func declType(v any, expr string) string {
+	t := reflect.TypeOf(v)
+	if t == nil || t.PkgPath() != "" {
+		return ""
+	}
+	switch t.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Complex64:
+		return t.String()
+	case reflect.Float64:
+		// Integral floats are represented without a decimal point, eg. 2.
+		if !strings.ContainsAny(expr, ".eE") && !strings.HasPrefix(expr, "math.") {
+			return t.String()
+		}
+	}
+	return ""
+}
+
+// Reports whether v is represented as a constant expression.
+func isConstant(v reflect.Value) bool {
+	if !v.IsValid() || constructor(v) != nil || namedRenderer(v.Type()) != nil || v.Type().Implements(goStringerType) {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	case reflect.Float32, reflect.Float64:
+		return !math.IsNaN(v.Float()) && !math.IsInf(v.Float(), 0)
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		return !math.IsNaN(real(c)) && !math.IsInf(real(c), 0) && !math.IsNaN(imag(c)) && !math.IsInf(imag(c), 0)
+	}
+	return false
+}
+
+// WriteFixtureFile writes v to path as a Go source file in package pkg, declaring a variable
+// called varName.
+//
+// If the TestFile option is given, path is renamed to end in "_test.go".
+func WriteFixtureFile(path, pkg, varName string, v any, options ...Option) error {
+	p := New(io.Discard, options...)
+	if p.testFile && !strings.HasSuffix(path, "_test.go") {
+		path = strings.TrimSuffix(path, ".go") + "_test.go"
+	}
+	source, err := GoFile(pkg, varName, v, options...)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, source, 0o644) // nolint: gosec
+}
+
+// WriteFixtureFiles writes each of values to its own Go source file in dir, in package pkg.
+//
+// fileName returns the file name for each variable name. If it is nil, the lower-cased variable
+// name with a ".go" extension is used. Files are written in sorted order of variable name.
+func WriteFixtureFiles(dir, pkg string, values map[string]any, fileName func(name string) string, options ...Option) error {
+	if fileName == nil {
+		fileName = func(name string) string { return strings.ToLower(name) + ".go" }
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := WriteFixtureFile(filepath.Join(dir, fileName(name)), pkg, name, values[name], options...); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// The packages imported by a generated file, keyed by the name they are imported as.
+type importSet struct {
+	local  string // Name of the package being generated.
+	names  map[string]string
+	byPath map[string]string
+	// Packages of types that were printed, which expressions such as the output of GoString() methods
+	// may refer to by their package names.
+	collected map[string]string
+}
+
+func newImportSet(local string) *importSet {
+	s := &importSet{local: local, names: map[string]string{}, byPath: map[string]string{}, collected: map[string]string{}}
+	// Names that generated expressions may use without a type referring to them are never reused.
+	for name, pkg := range implicitImports {
+		s.names[name], s.byPath[pkg] = pkg, name
+	}
+	return s
+}
+
+// Returns the name to import the package at path as, given that its package name is name. Packages
+// with the same name are imported with numbered aliases, eg. "foo2".
+func (s *importSet) name(path, name string) string {
+	if name == s.local {
+		return name
+	}
+	if imported, ok := s.byPath[path]; ok {
+		return imported
+	}
+	alias := name
+	for i := 2; s.names[alias] != "" || alias == s.local; i++ {
+		alias = fmt.Sprintf("%s%d", name, i)
+	}
+	s.names[alias], s.byPath[path] = path, alias
+	return alias
+}
+
+// Records the package of every named type referenced by t. Unlike the packages of type names that
+// are written, these are not given aliases, as expressions can only refer to them by package name.
+func (s *importSet) collect(t reflect.Type) {
+	if t.Name() != "" {
+		if name := strings.TrimLeft(strings.SplitN(t.String(), ".", 2)[0], "*"); t.PkgPath() != "" && s.collected[name] == "" {
+			s.collected[name] = t.PkgPath()
+		}
+		return
+	}
+	switch t.Kind() {
+	case reflect.Array, reflect.Slice, reflect.Ptr, reflect.Chan:
+		s.collect(t.Elem())
+	case reflect.Map:
+		s.collect(t.Key())
+		s.collect(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			s.collect(t.Field(i).Type)
+		}
+	case reflect.Func:
+		for i := 0; i < t.NumIn(); i++ {
+			s.collect(t.In(i))
+		}
+		for i := 0; i < t.NumOut(); i++ {
+			s.collect(t.Out(i))
+		}
+	}
+}
+
+// Matches the qualified names in the type arguments of a generic type, which reflect qualifies with
+// the import path of their package, eg. "github.com/x/foo.Bar".
+var qualifiedTypeArg = regexp.MustCompile(`([\w.\-~]+(?:/[\w.\-~]+)*)\.(\w+)`)
+
+// Returns the name of named type t, qualified with the name its package is imported as.
+func (s *importSet) typeName(t reflect.Type) string {
+	if t.PkgPath() == "" {
+		return t.String()
+	}
+	name := t.Name()
+	if i := strings.Index(name, "["); i >= 0 {
+		name = name[:i] + qualifiedTypeArg.ReplaceAllStringFunc(name[i:], func(arg string) string {
+			m := qualifiedTypeArg.FindStringSubmatch(arg)
+			return s.name(m[1], packageName(m[1])) + "." + m[2]
+		})
+	}
+	return s.name(t.PkgPath(), strings.TrimLeft(strings.SplitN(t.String(), ".", 2)[0], "*")) + "." + name
+}
+
+// Returns the likely name of the package at import path pkg, which is only known for packages that
+// declare a type printed with its package name.
+func packageName(pkg string) string {
+	name := path.Base(pkg)
+	if len(name) > 1 && name[0] == 'v' && strings.Trim(name[1:], "0123456789") == "" && path.Dir(pkg) != "." {
+		// Major version suffixes are not part of the package name, eg. "github.com/x/foo/v2".
+		name = path.Base(path.Dir(pkg))
+	}
+	name = strings.TrimPrefix(name, "go-")
+	return strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, name)
+}
+
+// Removes the qualifier from references to package local in expr, which is generated in that package.
+func unqualify(expr, local string) string {
+	fset := token.NewFileSet()
+	src := []byte(expr)
+	var s scanner.Scanner
+	s.Init(fset.AddFile("", fset.Base(), len(src)), src, nil, scanner.ScanComments)
+	out := &strings.Builder{}
+	last := 0
+	prev, qualifier := token.ILLEGAL, -1
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		offset := fset.Position(pos).Offset
+		if tok == token.PERIOD && qualifier >= 0 {
+			out.Write(src[last:qualifier])
+			last = offset + 1
+		}
+		qualifier = -1
+		if tok == token.IDENT && lit == local && prev != token.PERIOD {
+			qualifier = offset
+		}
+		prev = tok
+	}
+	out.Write(src[last:])
+	return out.String()
+}
+
+// Writes an import block for each package qualifier referenced in exprs, other than local, the
+// package being generated.
+func writeImports(w *bytes.Buffer, exprs []string, local string, imports *importSet) {
+	used := map[string]string{}
+	for _, expr := range exprs {
+		node, err := parser.ParseExpr(expr)
+		if err != nil {
+			continue
+		}
+		ast.Inspect(node, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if ident, ok := sel.X.(*ast.Ident); ok && ident.Name != local {
+					if pkg, ok := imports.names[ident.Name]; ok {
+						used[ident.Name] = pkg
+					} else if pkg, ok := imports.collected[ident.Name]; ok {
+						used[ident.Name] = pkg
+					}
+				}
+			}
+			return true
+		})
+	}
+	if len(used) == 0 {
+		return
+	}
+	names := make([]string, 0, len(used))
+	for name := range used {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return used[names[i]] < used[names[j]] })
+	fmt.Fprintln(w, "import (")
+	for _, name := range names {
+		if pkg := used[name]; path.Base(pkg) == name {
+			fmt.Fprintf(w, "\t%q\n", pkg)
+		} else {
+			fmt.Fprintf(w, "\t%s %q\n", name, pkg)
+		}
+	}
+	fmt.Fprint(w, ")\n\n")
+}
+
+func writeProvenance(w *bytes.Buffer, vars []Var, options []Option) {
+	fmt.Fprintln(w, "// Code generated by repr; DO NOT EDIT.")
+	fmt.Fprintln(w, "//")
+	for _, v := range vars {
+		t := reflect.TypeOf(v.Value)
+		if t == nil {
+			continue
+		}
+		if len(vars) == 1 {
+			fmt.Fprintf(w, "// type: %s\n", substAny(t))
+		} else {
+			fmt.Fprintf(w, "// type: %s %s\n", v.Name, substAny(t))
+		}
+		for t.Name() == "" && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			t = t.Elem()
+		}
+		if t.PkgPath() != "" {
+			fmt.Fprintf(w, "// package: %s\n", t.PkgPath())
+		}
+	}
+	fmt.Fprintf(w, "// repr: %s\n", version())
+	names := make([]string, len(options))
+	for i, option := range options {
+		names[i] = optionName(option)
+	}
+	fmt.Fprintf(w, "// options: %s\n\n", strings.Join(names, ", "))
+}
+
+// Returns the version of the repr module in the current binary.
+func version() string {
+	const module = "github.com/alecthomas/repr"
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if info.Main.Path == module {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == module {
+			if dep.Replace != nil {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+	return "unknown"
+}
+
+// Returns the name of the function that created option, eg. "StrictGo".
+func optionName(option Option) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(option).Pointer())
+	if fn == nil {
+		return "unknown"
+	}
+	name := fn.Name()
+	if i := strings.Index(name, "["); i >= 0 {
+		// Generic options, eg. "Hide[...]".
+		name = name[:i] + strings.TrimPrefix(name[strings.LastIndex(name, "]")+1:], "]")
+	}
+	name = strings.TrimSuffix(name, ".func1")
+	return strings.TrimPrefix(name, "github.com/alecthomas/repr.")
+}
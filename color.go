@@ -0,0 +1,135 @@
+package repr
+
+import (
+	"html"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+type colorMode int
+
+const (
+	colorNever colorMode = iota
+	colorAuto
+	colorAlways
+)
+
+// Theme sets the colours of each class of token in coloured output.
+//
+// Colours are ANSI SGR parameters, eg. "36" for cyan or "1;31" for bold red. Empty colours are not
+// coloured.
+type Theme struct {
+	Type    string
+	Field   string
+	String  string
+	Number  string
+	Comment string
+	// Lines added and removed in diffs.
+	DiffAdd    string
+	DiffRemove string
+}
+
+// DefaultTheme is the theme used for coloured output unless the Colors option is given.
+var DefaultTheme = Theme{
+	Type:       "36",
+	Field:      "34",
+	String:     "32",
+	Number:     "35",
+	Comment:    "90",
+	DiffAdd:    "32",
+	DiffRemove: "31",
+}
+
+// Classes of tokens that are coloured differently.
+type tokenClass int
+
+const (
+	typeToken tokenClass = iota
+	fieldToken
+	stringToken
+	numberToken
+	commentToken
+	diffAddToken
+	diffRemoveToken
+)
+
+// Returns the colour of a class of token.
+func (t *Theme) color(class tokenClass) string {
+	switch class {
+	case typeToken:
+		return t.Type
+	case fieldToken:
+		return t.Field
+	case stringToken:
+		return t.String
+	case numberToken:
+		return t.Number
+	case commentToken:
+		return t.Comment
+	case diffAddToken:
+		return t.DiffAdd
+	case diffRemoveToken:
+		return t.DiffRemove
+	}
+	return ""
+}
+
+// Returns s coloured as the given class of token, if colour is enabled.
+func (p *Printer) paint(class tokenClass, s string) string {
+	if !p.colored || s == "" {
+		return s
+	}
+	color := p.theme.color(class)
+	if color == "" {
+		return s
+	}
+	return "\x1b[" + color + "m" + s + "\x1b[0m"
+}
+
+// Writes s coloured as the given class of token, if colour is enabled. In HTML output the token is
+// wrapped in a <span> written as markup, so s itself is always escaped.
+func (p *Printer) writeToken(class tokenClass, s string) {
+	if p.html && p.colored && s != "" {
+		if color := p.theme.color(class); color != "" {
+			p.markup(`<span class="` + html.EscapeString(color) + `">`)
+			io.WriteString(p.w, s) // nolint: errcheck
+			p.markup("</span>")
+			return
+		}
+	}
+	io.WriteString(p.w, p.paint(class, s)) // nolint: errcheck
+}
+
+// Writes a comment containing text.
+func (p *Printer) writeComment(text string) {
+	p.writeToken(commentToken, "/* "+strings.ReplaceAll(text, "*/", "* /")+" */")
+}
+
+// Returns the number of columns occupied by s, excluding ANSI escape sequences.
+func visibleWidth(s string) int {
+	width := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\x1b' && i+1 < len(s) && s[i+1] == '[' {
+			// Skip to the final byte of the CSI sequence.
+			for i += 2; i < len(s) && (s[i] < 0x40 || s[i] > 0x7e); i++ {
+			}
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size - 1
+		width++
+	}
+	return width
+}
+
+// Reports whether w is a terminal.
+func isTerminal(w any) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,135 @@
+package repr
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// MaxGzipSize is the most bytes GzipDecoder decompresses. Data that decompresses to more, such as a
+// gzip bomb, is not decoded.
+const MaxGzipSize = 1 << 20
+
+// Decoder decodes payloads stored in string or []byte struct fields, for DecodeFields.
+type Decoder struct {
+	// Name of the encoding, noted in a comment after decoded values.
+	Name string
+	// Decode returns the decoded form of data, or false if data is not in this encoding. Decoded
+	// strings and []byte values are decoded again, so that eg. gzipped JSON is fully decoded.
+	Decode func(data []byte) (any, bool)
+}
+
+var (
+	// GzipDecoder decompresses gzip data of up to MaxGzipSize bytes.
+	GzipDecoder = Decoder{Name: "gzip", Decode: func(data []byte) (any, bool) {
+		if !bytes.HasPrefix(data, gzipMagic) {
+			return nil, false
+		}
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, false
+		}
+		out, err := io.ReadAll(io.LimitReader(r, MaxGzipSize+1))
+		if err != nil || len(out) > MaxGzipSize {
+			return nil, false
+		}
+		return out, true
+	}}
+	// Base64Decoder decodes standard, padded base64 that decodes to text or gzip data. Other strings
+	// that happen to be valid base64, such as some short words, are left alone.
+	Base64Decoder = Decoder{Name: "base64", Decode: func(data []byte) (any, bool) {
+		out, err := base64.StdEncoding.DecodeString(string(data))
+		if err != nil || len(out) == 0 || !isText(out) && !bytes.HasPrefix(out, gzipMagic) {
+			return nil, false
+		}
+		return out, true
+	}}
+	// JSONDecoder decodes JSON objects and arrays.
+	JSONDecoder = Decoder{Name: "json", Decode: func(data []byte) (any, bool) {
+		trimmed := bytes.TrimSpace(data)
+		if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+			return nil, false
+		}
+		var out any
+		if err := json.Unmarshal(trimmed, &out); err != nil {
+			return nil, false
+		}
+		return out, true
+	}}
+)
+
+// DecodeFields prints the decoded form of string and []byte struct fields for which filter returns
+// true, or all such fields if filter is nil, followed by a comment noting the encodings, eg.
+// `Body: map[string]any{"id": float64(1)} /* decoded from base64, gzip, json */`.
+//
+// The decoders are tried in order, repeatedly, until none apply. Fields that no decoder applies to
+// are printed as usual. If no decoders are given, GzipDecoder, JSONDecoder and Base64Decoder are
+// used. Decoding is disabled in StrictGo mode, as decoded values have a different type.
+func DecodeFields(filter func(field reflect.StructField) bool, decoders ...Decoder) Option {
+	if len(decoders) == 0 {
+		decoders = []Decoder{GzipDecoder, JSONDecoder, Base64Decoder}
+	}
+	return func(o *Printer) {
+		o.decodeFilter = filter
+		if o.decodeFilter == nil {
+			o.decodeFilter = func(reflect.StructField) bool { return true }
+		}
+		o.decoders = decoders
+	}
+}
+
+// Returns the decoded form of struct field v, and the encodings it was decoded from.
+func (p *Printer) decodeField(field *fieldPlan, v reflect.Value) (reflect.Value, string, bool) {
+	if p.decoders == nil || p.strictGo || !p.decodeFilter(field.StructField) {
+		return v, "", false
+	}
+	var data []byte
+	switch {
+	case v.Kind() == reflect.String:
+		data = []byte(v.String())
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		data = v.Bytes()
+	default:
+		return v, "", false
+	}
+	var (
+		decoded   any
+		encodings []string
+	)
+	// Bound the number of rounds, in case a decoder always succeeds.
+	for round := 0; round < 8 && data != nil; round++ {
+		matched := false
+		for _, d := range p.decoders {
+			out, ok := d.Decode(data)
+			if !ok {
+				continue
+			}
+			matched = true
+			encodings = append(encodings, d.Name)
+			decoded, data = out, nil
+			switch out := out.(type) {
+			case []byte:
+				data = out
+			case string:
+				data = []byte(out)
+			}
+			break
+		}
+		if !matched {
+			break
+		}
+	}
+	if len(encodings) == 0 {
+		return v, "", false
+	}
+	if b, ok := decoded.([]byte); ok && isText(b) {
+		decoded = string(b)
+	}
+	return reflect.ValueOf(decoded), strings.Join(encodings, ", "), true
+}
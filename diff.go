@@ -0,0 +1,144 @@
+package repr
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Number of unchanged lines printed before and after each change by Diff.
+const diffContext = 1
+
+// Diff returns a unified diff between the representations of a and b, or "" if they are represented
+// identically.
+//
+// Values are flattened as with Flatten and compared path by path, so only values that differ are
+// printed, each with the unchanged line before and after it for context. Hunks of changes that are
+// not adjacent are separated by a "@@" line, eg.
+//
+//	  Name = "web"
+//	- Spec.Replicas = 2
+//	+ Spec.Replicas = 3
+//	  Spec.Image = "nginx"
+//	@@
+//	  Spec.Ports[2] = 8080
+//	+ Spec.Ports[3] = 8443
+//
+// If a and b are of different types, such as int and int64, the types are compared on a "<type>"
+// line, as their flattened representations may not otherwise differ.
+func Diff(a, b any, options ...Option) string {
+	p := New(nil, append(append([]Option{}, options...), Flatten())...)
+	colored := p.colorMode == colorAlways
+	p.colorMode = colorNever
+	from, to := p.collectFlattened(a), p.collectFlattened(b)
+	if ta, tb := reflect.TypeOf(a), reflect.TypeOf(b); ta != tb {
+		from = append([]flatEntry{{"<type>", diffType(ta)}}, from...)
+		to = append([]flatEntry{{"<type>", diffType(tb)}}, to...)
+	}
+	lines := diffEntries(from, to)
+	p.colored = colored
+	return p.formatDiff(lines)
+}
+
+// Returns the name of t for the "<type>" line of a diff.
+func diffType(t reflect.Type) string {
+	if t == nil {
+		return "nil"
+	}
+	return substAny(t)
+}
+
+// Returns the lines of the flattened representation of v.
+func (p *Printer) collectFlattened(v any) []flatEntry {
+	entries := []flatEntry{}
+	c := *p
+	c.flatEntries = &entries
+	c.Sprint(v)
+	return entries
+}
+
+// A line of a diff; op is ' ' for unchanged lines, '-' for removed lines or '+' for added lines.
+type diffLine struct {
+	op byte
+	flatEntry
+}
+
+// Merges the lines of two flattened values by path.
+func diffEntries(from, to []flatEntry) []diffLine {
+	// Paths that have not been consumed yet.
+	inFrom := make(map[string]bool, len(from))
+	for _, e := range from {
+		inFrom[e.path] = true
+	}
+	inTo := make(map[string]bool, len(to))
+	for _, e := range to {
+		inTo[e.path] = true
+	}
+	lines := []diffLine{}
+	i, j := 0, 0
+	for i < len(from) || j < len(to) {
+		switch {
+		case i < len(from) && j < len(to) && from[i].path == to[j].path:
+			if from[i].value == to[j].value {
+				lines = append(lines, diffLine{' ', to[j]})
+			} else {
+				lines = append(lines, diffLine{'-', from[i]}, diffLine{'+', to[j]})
+			}
+			delete(inFrom, from[i].path)
+			delete(inTo, to[j].path)
+			i++
+			j++
+
+		case j < len(to) && !inFrom[to[j].path]:
+			lines = append(lines, diffLine{'+', to[j]})
+			delete(inTo, to[j].path)
+			j++
+
+		default:
+			// Either the path was removed, or it moved and is re-added when reached in to.
+			lines = append(lines, diffLine{'-', from[i]})
+			delete(inFrom, from[i].path)
+			i++
+		}
+	}
+	return lines
+}
+
+// Formats changed lines, and the unchanged lines around them.
+func (p *Printer) formatDiff(lines []diffLine) string {
+	w := &strings.Builder{}
+	last := -diffContext - 1 // Index of the last changed line.
+	printed := -1            // Index of the last line printed.
+	for i, line := range lines {
+		if line.op != ' ' {
+			last = i
+		} else if i-last > diffContext && !changedWithin(lines[i+1:], diffContext) {
+			continue
+		}
+		if printed >= 0 && i > printed+1 {
+			w.WriteString("@@\n")
+		}
+		printed = i
+		text := string(line.op) + " " + line.path + " = " + line.value
+		switch line.op {
+		case '-':
+			text = p.paint(diffRemoveToken, text)
+		case '+':
+			text = p.paint(diffAddToken, text)
+		}
+		w.WriteString(text + "\n")
+	}
+	if last < 0 {
+		return ""
+	}
+	return w.String()
+}
+
+// Reports whether any of the first n lines are changed.
+func changedWithin(lines []diffLine, n int) bool {
+	for i := 0; i < n && i < len(lines); i++ {
+		if lines[i].op != ' ' {
+			return true
+		}
+	}
+	return false
+}
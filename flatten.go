@@ -0,0 +1,121 @@
+package repr
+
+import (
+	"fmt"
+	"go/token"
+	"reflect"
+	"strings"
+)
+
+// Flatten prints one line for each scalar value within a value, of the form `path = value`, eg.
+// `Spec.Containers[0].Image = "nginx:1.25"`.
+//
+// Values that are printed as a whole, such as those with GoString() methods or registered
+// constructors, and empty or nil structs, slices and maps, are printed on a single line.
+func Flatten() Option { return func(o *Printer) { o.flatten = true } }
+
+// BareKeys prints string map keys that are identifiers without quotes in the paths printed by
+// Flatten and Diff, eg. `Labels[app] = "web"`. Go output always quotes keys, as Go requires.
+func BareKeys() Option { return func(o *Printer) { o.bareKeys = true } }
+
+// Prints v and its contents as lines of the form `path = value`.
+func (p *Printer) printFlattened(seen map[reflect.Value]bool, path string, v reflect.Value, isAnyValue bool) {
+	if p.expandable(seen, v) {
+		seen[v] = true
+		defer delete(seen, v)
+		v = accessible(v)
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			p.printFlattened(seen, path, v.Elem(), v.Kind() == reflect.Interface)
+
+		case reflect.Slice, reflect.Array:
+			for _, i := range p.sliceOrder(seen, v) {
+				p.printFlattened(seen, fmt.Sprintf("%s[%d]", path, i), v.Index(i), v.Type().Elem().Kind() == reflect.Interface)
+			}
+
+		case reflect.Map:
+			keys := v.MapKeys()
+			p.sortMapKeys(seen, keys)
+			for _, k := range p.withoutOmitted(v, keys) {
+				kp := path + "[" + p.flatKey(seen, k) + "]"
+				if kv := v.MapIndex(k); kv.IsValid() {
+					p.printFlattened(seen, kp, kv, v.Type().Elem().Kind() == reflect.Interface)
+				} else {
+					p.flatLine(kp, func(line *Printer) { line.printInvalid(kp) })
+				}
+			}
+
+		case reflect.Struct:
+			if !v.CanAddr() {
+				// Fields of unaddressable structs can't be accessed via unsafe, so copy it first.
+				src := reflect.New(v.Type()).Elem()
+				src.Set(v)
+				v = src
+			}
+			plan := planOf(v.Type())
+			for _, i := range p.fieldOrder(plan) {
+				field, f := &plan.fields[i], v.Field(i)
+				if p.hideField(field, f) || p.omitNil && isNil(f) || p.omitEmpty && p.isEmpty(f) {
+					continue
+				}
+				p.printFlattened(seen, path+"."+p.fieldName(field), f, field.Type.Kind() == reflect.Interface)
+			}
+		}
+		return
+	}
+	p.flatLine(path, func(line *Printer) { line.reprValue(seen, path, v, "", true, isAnyValue) })
+}
+
+// A single line of flattened output.
+type flatEntry struct {
+	path  string
+	value string
+}
+
+// Prints the line for the value at path, or collects it if flatEntries is set.
+func (p *Printer) flatLine(path string, print func(line *Printer)) {
+	line := *p
+	line.indent = ""
+	if p.flatEntries != nil {
+		w := &strings.Builder{}
+		line.w = w
+		print(&line)
+		*p.flatEntries = append(*p.flatEntries, flatEntry{displayPath(path), w.String()})
+		return
+	}
+	fmt.Fprintf(p.w, "%s = ", displayPath(path))
+	print(&line)
+	fmt.Fprintln(p.w)
+}
+
+// Reports whether v is flattened into its contents rather than printed as a whole.
+func (p *Printer) expandable(seen map[reflect.Value]bool, v reflect.Value) bool {
+	if !v.IsValid() || seen[v] || isNil(v) {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		if v.Len() == 0 || v.Type() == byteSliceType {
+			return false
+		}
+	case reflect.Struct:
+		if v.NumField() == 0 {
+			return false
+		}
+	case reflect.Ptr, reflect.Interface:
+	default:
+		return false
+	}
+	t := v.Type()
+	v = accessible(v)
+	return t != timeType && constructor(v) == nil && namedRenderer(t) == nil && p.summaries[t] == nil && p.kindFormatters[v.Kind()] == nil &&
+		(p.ignoreGoStringer || !t.Implements(goStringerType))
+}
+
+// Returns the representation of the map key k within a path.
+func (p *Printer) flatKey(seen map[reflect.Value]bool, k reflect.Value) string {
+	if p.bareKeys && k.Kind() == reflect.String && token.IsIdentifier(k.String()) {
+		return k.String()
+	}
+	return p.flatString(seen, k)
+}
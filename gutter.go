@@ -0,0 +1,113 @@
+package repr
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// GutterMode selects what is printed in the gutter before each line of output.
+type GutterMode int
+
+const (
+	// GutterNone prints no gutter. This is the default.
+	GutterNone GutterMode = iota
+	// GutterLineNumbers prints the line number of each line, starting at 1.
+	GutterLineNumbers
+	// GutterPaths prints the path of the value each line starts, eg. `Spec.Ports[3]`.
+	GutterPaths
+)
+
+// Gutter prefixes each line of output with a gutter separated from the value by "| ", so that lines of
+// large values can be referred to unambiguously, eg.
+//
+//	<root>   | main.Spec{
+//	Ports    |   Ports: []int{
+//	Ports[0] |     80,
+//
+// Gutters are aligned, so each value is held in memory until it has been printed.
+func Gutter(mode GutterMode) Option { return func(o *Printer) { o.gutter = mode } }
+
+// Records path as the path of the value that the next line printed starts, for GutterPaths.
+func (p *Printer) markLine(path string) {
+	if p.gutterW != nil {
+		p.gutterW.path = path
+	}
+}
+
+// A line of output held by a gutterWriter.
+type gutterLine struct {
+	label string
+	text  []byte
+}
+
+// Holds the lines of a value so that they can be written with an aligned gutter.
+type gutterWriter struct {
+	w      io.Writer
+	mode   GutterMode
+	html   bool // Whether output is escaped HTML, so labels must be escaped too.
+	active bool
+	path   string // Path of the value being printed, for GutterPaths.
+	lines  []gutterLine
+	open   bool // Whether the last line is incomplete.
+}
+
+// Starts holding the lines of a value.
+func (g *gutterWriter) start() {
+	g.active, g.path, g.lines, g.open = true, "", g.lines[:0], false
+}
+
+func (g *gutterWriter) Write(b []byte) (int, error) {
+	if !g.active {
+		return g.w.Write(b)
+	}
+	n := len(b)
+	for len(b) > 0 {
+		if !g.open {
+			label := strconv.Itoa(len(g.lines) + 1)
+			if g.mode == GutterPaths {
+				label = displayPath(g.path)
+			}
+			g.lines = append(g.lines, gutterLine{label: label})
+			g.open = true
+		}
+		line := &g.lines[len(g.lines)-1]
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			line.text = append(line.text, b...)
+			break
+		}
+		line.text = append(line.text, b[:i+1]...)
+		g.open = false
+		b = b[i+1:]
+	}
+	return n, nil
+}
+
+// Writes the lines held since start, and stops holding lines.
+func (g *gutterWriter) finish() error {
+	g.active = false
+	width := 0
+	for _, line := range g.lines {
+		if w := visibleWidth(line.label); w > width {
+			width = w
+		}
+	}
+	for _, line := range g.lines {
+		pad := strings.Repeat(" ", width-visibleWidth(line.label))
+		label := line.label + pad
+		if g.mode == GutterLineNumbers {
+			label = pad + line.label
+		}
+		if g.html {
+			label = html.EscapeString(label)
+		}
+		if _, err := fmt.Fprintf(g.w, "%s | %s", label, line.text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
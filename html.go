@@ -0,0 +1,120 @@
+package repr
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+// HTMLTheme is the theme used by HTML unless the Colors option is given. In HTML output the colours
+// of a theme are CSS classes.
+var HTMLTheme = Theme{
+	Type:       "repr-type",
+	Field:      "repr-field",
+	String:     "repr-string",
+	Number:     "repr-number",
+	Comment:    "repr-comment",
+	DiffAdd:    "repr-add",
+	DiffRemove: "repr-remove",
+}
+
+// HTMLStyle is a stylesheet for the output of HTML, using the classes of HTMLTheme.
+const HTMLStyle = `pre.repr details, pre.repr summary { display: inline; }
+pre.repr summary { cursor: pointer; list-style: none; }
+pre.repr summary::-webkit-details-marker { display: none; }
+pre.repr details:not([open]) > summary::after { content: "…"; }
+pre.repr .repr-type { color: #00838f; }
+pre.repr .repr-field { color: #1565c0; }
+pre.repr .repr-string { color: #2e7d32; }
+pre.repr .repr-number { color: #6a1b9a; }
+pre.repr .repr-comment { color: #757575; }
+pre.repr .repr-add { color: #2e7d32; }
+pre.repr .repr-remove { color: #c62828; }
+`
+
+// HTML returns the representation of v as an HTML <pre> element, with tokens wrapped in <span>s
+// classed according to the theme and structs, slices, arrays and maps that span more than one line
+// wrapped in collapsible <details> elements. See HTMLStyle for a suitable stylesheet.
+func HTML(v any, options ...Option) string {
+	w := &strings.Builder{}
+	options = append([]Option{Colors(HTMLTheme)}, options...)
+	options = append(options, func(o *Printer) { o.html = true })
+	p := New(w, options...)
+	w.WriteString(`<pre class="repr">`)
+	p.Print(v)
+	w.WriteString("</pre>")
+	return w.String()
+}
+
+// Writes s as markup, unescaped, beneath the htmlWriter that escapes everything else written to the
+// output. Output that isn't written through an htmlWriter, such as that of Sprint, has no markup.
+func (p *Printer) markup(s string) {
+	if h, ok := p.w.(*htmlWriter); ok {
+		io.WriteString(h.w, s) // nolint: errcheck
+	}
+}
+
+// Writes the type name of t, if not nil, followed by the opening brace of a composite value, which is
+// collapsible in HTML output if multiline.
+func (p *Printer) openComposite(t reflect.Type, indent string, multiline bool) {
+	collapsible := p.html && multiline
+	if collapsible {
+		p.markup("<details open><summary>")
+	}
+	if t != nil {
+		p.writeTypeName(t, indent)
+	}
+	fmt.Fprint(p.w, "{")
+	if collapsible {
+		p.markup("</summary>")
+	}
+}
+
+// Writes the closing brace of a composite value opened with openComposite, after the indentation in.
+func (p *Printer) closeComposite(in string, multiline bool) {
+	fmt.Fprint(p.w, in)
+	if p.html && multiline {
+		p.markup("</details>")
+	}
+	fmt.Fprint(p.w, "}")
+}
+
+// Escapes everything written to it for HTML. Markup is written to w directly, by Printer.markup.
+type htmlWriter struct {
+	w io.Writer
+}
+
+func (h *htmlWriter) Write(b []byte) (int, error) {
+	if _, err := io.WriteString(h.w, html.EscapeString(string(b))); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Returns the number of columns occupied by s, which is escaped HTML, excluding markup.
+func htmlWidth(s string) int {
+	width := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '<':
+			// Text is escaped, so '<' only starts markup.
+			if end := strings.IndexByte(s[i:], '>'); end >= 0 {
+				i += end
+				continue
+			}
+		case '&':
+			// An entity is a single escaped character.
+			if end := strings.IndexByte(s[i:], ';'); end >= 0 {
+				i += end
+			}
+		default:
+			_, size := utf8.DecodeRuneInString(s[i:])
+			i += size - 1
+		}
+		width++
+	}
+	return width
+}
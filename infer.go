@@ -0,0 +1,172 @@
+package repr
+
+import (
+	"fmt"
+	"go/format"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Common initialisms, capitalised in field names generated by InferStruct.
+var initialisms = map[string]bool{
+	"API": true, "ASCII": true, "CPU": true, "CSS": true, "DNS": true, "HTML": true, "HTTP": true,
+	"HTTPS": true, "ID": true, "IP": true, "JSON": true, "SQL": true, "SSH": true, "TCP": true,
+	"TLS": true, "TTL": true, "UDP": true, "UI": true, "URI": true, "URL": true, "UUID": true,
+	"XML": true,
+}
+
+// InferStruct returns a Go type declaration for a struct named name that v, typically a map[string]any
+// decoded from JSON or YAML, can be decoded into.
+//
+// Fields are tagged with their original json key. Nested maps become nested struct types, the element
+// types of slices are merged, and values with conflicting or unknown types become any.
+func InferStruct(name string, v any) string {
+	w := &strings.Builder{}
+	fmt.Fprintf(w, "type %s ", name)
+	inferType(reflect.ValueOf(v)).write(w)
+	source, err := format.Source([]byte(w.String()))
+	if err != nil {
+		return w.String()
+	}
+	return string(source)
+}
+
+// An inferred type. Exactly one of typ, fields or elem is set, or none if the type is unknown.
+type inferred struct {
+	typ    string
+	fields []inferredField
+	elem   *inferred
+	slice  bool
+}
+
+type inferredField struct {
+	key  string
+	typ  *inferred
+	name string
+}
+
+func inferType(v reflect.Value) *inferred {
+	for v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	switch {
+	case v.Kind() == reflect.Invalid || v.Kind() == reflect.Interface:
+		return &inferred{}
+
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		out := &inferred{fields: []inferredField{}}
+		names := map[string]int{}
+		for _, key := range keys {
+			name := fieldName(key.String())
+			names[name]++
+			if n := names[name]; n > 1 {
+				name = fmt.Sprintf("%s%d", name, n)
+			}
+			out.fields = append(out.fields, inferredField{key: key.String(), name: name, typ: inferType(v.MapIndex(key))})
+		}
+		return out
+
+	case (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type() != byteSliceType:
+		var elem *inferred
+		for i := 0; i < v.Len(); i++ {
+			elem = mergeInferred(elem, inferType(v.Index(i)))
+		}
+		if elem == nil {
+			elem = &inferred{}
+		}
+		return &inferred{elem: elem, slice: true}
+	}
+	return &inferred{typ: substAny(v.Type())}
+}
+
+func (i *inferred) unknown() bool { return i.typ == "" && i.fields == nil && !i.slice }
+
+// Merges two inferred types, returning an unknown type if they conflict.
+func mergeInferred(a, b *inferred) *inferred {
+	switch {
+	case a == nil || a.unknown():
+		return b
+	case b.unknown():
+		return a
+	case a.typ != "" && a.typ == b.typ:
+		return a
+	case a.slice && b.slice:
+		return &inferred{elem: mergeInferred(a.elem, b.elem), slice: true}
+	case a.fields != nil && b.fields != nil:
+		out := &inferred{fields: append([]inferredField{}, a.fields...)}
+	next:
+		for _, bf := range b.fields {
+			for i, af := range out.fields {
+				if af.key == bf.key {
+					out.fields[i].typ = mergeInferred(af.typ, bf.typ)
+					continue next
+				}
+			}
+			out.fields = append(out.fields, bf)
+		}
+		return out
+	}
+	return &inferred{}
+}
+
+func (i *inferred) write(w *strings.Builder) {
+	switch {
+	case i.typ != "":
+		w.WriteString(i.typ)
+	case i.slice:
+		w.WriteString("[]")
+		i.elem.write(w)
+	case i.fields != nil:
+		w.WriteString("struct {\n")
+		for _, field := range i.fields {
+			fmt.Fprintf(w, "%s ", field.name)
+			field.typ.write(w)
+			fmt.Fprintf(w, " `json:%q`\n", field.key)
+		}
+		w.WriteString("}")
+	default:
+		w.WriteString("any")
+	}
+}
+
+// Converts a json key such as "user_id" or "firstName" into an exported Go identifier.
+func fieldName(key string) string {
+	words := []string{}
+	word := []rune{}
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = word[:0]
+		}
+	}
+	runes := []rune(key)
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+			continue
+		case unicode.IsUpper(r) && i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))):
+			flush()
+		}
+		word = append(word, r)
+	}
+	flush()
+	name := &strings.Builder{}
+	for _, word := range words {
+		if upper := strings.ToUpper(word); initialisms[upper] {
+			name.WriteString(upper)
+		} else {
+			rs := []rune(strings.ToLower(word))
+			rs[0] = unicode.ToUpper(rs[0])
+			name.WriteString(string(rs))
+		}
+	}
+	if name.Len() == 0 || !unicode.IsLetter([]rune(name.String())[0]) {
+		return "F" + name.String()
+	}
+	return name.String()
+}
@@ -0,0 +1,98 @@
+package repr
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// MaterializeIterators prints range-over-func iterators, funcs of the form func(yield func(V) bool)
+// or func(yield func(K, V) bool) such as iter.Seq and iter.Seq2, by calling them and printing up to
+// max of the values they yield, eg. `iter.Seq[int]{1, 2, 3}`.
+//
+// Iterators are called while printing, so must be safe to call more than once. Panics are recovered
+// and reported, and the iterator is printed as its type. Iterators are not called in StrictGo mode.
+func MaterializeIterators(max int) Option { return func(o *Printer) { o.maxIterations = max } }
+
+// Reports whether t is a range-over-func iterator type.
+func isIterator(t reflect.Type) bool {
+	if t.Kind() != reflect.Func || t.NumIn() != 1 || t.NumOut() != 0 {
+		return false
+	}
+	yield := t.In(0)
+	return yield.Kind() == reflect.Func && (yield.NumIn() == 1 || yield.NumIn() == 2) &&
+		yield.NumOut() == 1 && yield.Out(0).Kind() == reflect.Bool
+}
+
+// Calls iterator v, returning up to max yielded values, each a single value or a key and value, and
+// whether more were available.
+func iterate(v reflect.Value, max int) (values [][]reflect.Value, more bool) {
+	yieldType := v.Type().In(0)
+	yield := reflect.MakeFunc(yieldType, func(args []reflect.Value) []reflect.Value {
+		if len(values) == max {
+			more = true
+			return []reflect.Value{reflect.ValueOf(false).Convert(yieldType.Out(0))}
+		}
+		values = append(values, args)
+		return []reflect.Value{reflect.ValueOf(true).Convert(yieldType.Out(0))}
+	})
+	v.Call([]reflect.Value{yield})
+	return values, more
+}
+
+// Prints iterator v as the values it yields, returning false if it could not be called.
+func (p *Printer) printIterator(seen map[reflect.Value]bool, path string, v reflect.Value, indent string) bool {
+	var (
+		values [][]reflect.Value
+		more   bool
+	)
+	_, ok := p.safely(path, "iterator "+v.Type().String(), func() string {
+		values, more = iterate(v, p.maxIterations)
+		return ""
+	})
+	if !ok {
+		return false
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+	in := p.thisIndent(indent)
+	ni := p.nextIndent(indent)
+	p.writeTypeName(v.Type(), indent)
+	fmt.Fprint(p.w, "{")
+	if len(values) == 0 && !more {
+		fmt.Fprint(p.w, "}")
+		return true
+	}
+	if p.indent != "" {
+		fmt.Fprintln(p.w)
+	}
+	for i, args := range values {
+		fmt.Fprint(p.w, ni)
+		ep := path + "[" + strconv.Itoa(i) + "]"
+		if len(args) == 2 {
+			p.reprValue(seen, ep, args[0], ni, p.alwaysIncludeType || p.explicitTypes, args[0].Kind() == reflect.Interface)
+			fmt.Fprint(p.w, ": ")
+			args = args[1:]
+		}
+		p.reprValue(seen, ep, args[0], ni, p.alwaysIncludeType || p.explicitTypes, args[0].Kind() == reflect.Interface)
+		if p.indent != "" {
+			fmt.Fprint(p.w, ",\n")
+		} else if i < len(values)-1 || more {
+			fmt.Fprint(p.w, ", ")
+		}
+	}
+	if more {
+		p.warn(path, "iterator truncated")
+		fmt.Fprint(p.w, ni)
+		if p.layoutVersion < 6 {
+			p.writeComment("more elided")
+		} else {
+			p.writeComment(p.markers.Truncated)
+		}
+		if p.indent != "" {
+			fmt.Fprintln(p.w)
+		}
+	}
+	fmt.Fprintf(p.w, "%s}", in)
+	return true
+}
@@ -0,0 +1,254 @@
+package repr
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// OutputFormat is the syntax that values are printed in.
+type OutputFormat int
+
+const (
+	// GoSyntax prints values as Go expressions. This is the default.
+	GoSyntax OutputFormat = iota
+	// JSON prints values as JSON, as described by JSONString.
+	JSON
+)
+
+// Format sets the syntax that values are printed in. Options such as Hide, HideField, OmitEmpty and
+// IgnorePrivate apply to every format.
+func Format(format OutputFormat) Option { return func(o *Printer) { o.format = format } }
+
+// MapEntries prints maps in JSON as arrays of {"key": k, "value": v} objects, in the order that String
+// prints their entries, rather than as objects. Consumers that decode JSON objects into hash maps lose
+// the order of their keys, and JSON object keys can only be strings, whereas keys in entries keep their
+// JSON representation.
+func MapEntries() Option { return func(o *Printer) { o.jsonMapEntries = true } }
+
+// JSONString returns v as JSON that corresponds field for field with the output of String given the
+// same options. It is equivalent to String with the Format(JSON) option.
+//
+// Struct fields are named, ordered and omitted as they are by String, and map entries and slice
+// elements appear in the same order. Values that String represents as a single expression rather
+// than as a composite literal, such as those with GoString() methods or registered constructors, and
+// scalars without a JSON equivalent, such as NaN and complex numbers, are JSON strings containing
+// that expression. Text []byte values are strings. Cycles, channels and funcs are null.
+//
+// The output is compact unless an Indent option is given.
+func JSONString(v any, options ...Option) string {
+	return String(v, append(options, Format(JSON))...)
+}
+
+// Prints v as JSON.
+func (p *Printer) printJSON(seen map[reflect.Value]bool, v reflect.Value) {
+	w := &bytes.Buffer{}
+	p.writeJSON(w, seen, v)
+	if p.indent == "" {
+		_, _ = p.w.Write(w.Bytes())
+		return
+	}
+	out := &bytes.Buffer{}
+	_ = json.Indent(out, w.Bytes(), "", p.indent)
+	_, _ = p.w.Write(out.Bytes())
+}
+
+func (p *Printer) writeJSON(w *bytes.Buffer, seen map[reflect.Value]bool, v reflect.Value) {
+	if !v.IsValid() {
+		w.WriteString("null")
+		return
+	}
+	if isNil(v) {
+		switch {
+		case p.nilAsEmpty && v.Kind() == reflect.Slice:
+			w.WriteString("[]")
+		case p.nilAsEmpty && v.Kind() == reflect.Map:
+			w.WriteString("{}")
+		default:
+			w.WriteString("null")
+		}
+		return
+	}
+	if canCycle(v.Kind()) && seen[v] {
+		w.WriteString("null")
+		return
+	}
+	av := accessible(v)
+	t := av.Type()
+	if t == byteSliceType && p.bytesFormat != BytesHex && isText(av.Bytes()) {
+		writeJSONString(w, string(av.Bytes()))
+		return
+	}
+	// Opaque values are rendered before v is marked as seen, which would make them cycles.
+	if p.isOpaque(av) {
+		writeJSONString(w, p.flatString(seen, av))
+		return
+	}
+	if canCycle(v.Kind()) {
+		seen[v] = true
+		defer delete(seen, v)
+	}
+	v = av
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		p.writeJSON(w, seen, v.Elem())
+
+	case reflect.Struct:
+		if !v.CanAddr() {
+			// Fields of unaddressable structs can't be accessed via unsafe, so copy it first.
+			src := reflect.New(t).Elem()
+			src.Set(v)
+			v = src
+		}
+		w.WriteByte('{')
+		plan := planOf(t)
+		first := true
+		for _, i := range p.fieldOrder(plan) {
+			field, f := &plan.fields[i], v.Field(i)
+			if p.hideField(field, f) || p.omitNil && isNil(f) || p.omitEmpty && p.isEmpty(f) {
+				continue
+			}
+			if !first {
+				w.WriteByte(',')
+			}
+			first = false
+			writeJSONString(w, p.fieldName(field))
+			w.WriteByte(':')
+			p.writeJSON(w, seen, f)
+		}
+		w.WriteByte('}')
+
+	case reflect.Slice, reflect.Array:
+		w.WriteByte('[')
+		for i, j := range p.sliceOrder(seen, v) {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			p.writeJSON(w, seen, v.Index(j))
+		}
+		w.WriteByte(']')
+
+	case reflect.Map:
+		keys := v.MapKeys()
+		p.sortMapKeys(seen, keys)
+		if p.jsonMapEntries {
+			w.WriteByte('[')
+			for i, k := range p.withoutOmitted(v, keys) {
+				if i > 0 {
+					w.WriteByte(',')
+				}
+				w.WriteString(`{"key":`)
+				p.writeJSON(w, seen, k)
+				w.WriteString(`,"value":`)
+				p.writeJSON(w, seen, v.MapIndex(k))
+				w.WriteByte('}')
+			}
+			w.WriteByte(']')
+			return
+		}
+		w.WriteByte('{')
+		for i, k := range p.withoutOmitted(v, keys) {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			// JSON keys are always strings, so keys are written without quotes or type conversions.
+			if k.Kind() == reflect.Interface && !k.IsNil() {
+				k = k.Elem()
+			}
+			if k.Kind() == reflect.String {
+				writeJSONString(w, k.String())
+			} else {
+				writeJSONString(w, p.flatString(seen, k))
+			}
+			w.WriteByte(':')
+			p.writeJSON(w, seen, v.MapIndex(k))
+		}
+		w.WriteByte('}')
+
+	case reflect.Bool:
+		w.WriteString(strconv.FormatBool(v.Bool()))
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		w.WriteString(strconv.FormatInt(v.Int(), 10))
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		w.WriteString(strconv.FormatUint(v.Uint(), 10))
+
+	case reflect.Uintptr, reflect.UnsafePointer:
+		writeJSONString(w, p.address(v))
+
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			writeJSONString(w, p.flatString(seen, v))
+			return
+		}
+		bits := 64
+		if v.Kind() == reflect.Float32 {
+			bits = 32
+		}
+		w.WriteString(strconv.FormatFloat(f, 'g', -1, bits))
+
+	case reflect.String:
+		writeJSONString(w, v.String())
+
+	case reflect.Chan, reflect.Func:
+		w.WriteString("null")
+
+	default:
+		writeJSONString(w, p.flatString(seen, v))
+	}
+}
+
+// Reports whether v is represented by a single expression rather than by its contents, such as
+// time.Time, values with GoString() methods, registered constructors, or types with Stringer-style
+// output.
+func (p *Printer) isOpaque(v reflect.Value) bool {
+	t := v.Type()
+	if t == timeType || constructor(v) != nil || namedRenderer(t) != nil || p.summaries[t] != nil || p.kindFormatters[t.Kind()] != nil {
+		return true
+	}
+	if !p.ignoreGoStringer && t.Implements(goStringerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map, reflect.Ptr, reflect.Interface,
+		reflect.String, reflect.Chan, reflect.Func:
+		return false
+	}
+	// Scalars whose String() method changes how they are represented, eg. time.Duration(1s).
+	return t.Name() != realKindName[t.Kind()] && v.CanInterface() && (t.Implements(stringerType) || t.Implements(errorType))
+}
+
+func writeJSONString(w *bytes.Buffer, s string) {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	// Encode appends a newline.
+	w.Truncate(w.Len() - 1)
+}
+
+// Value wraps a value so that encoders that support encoding.TextMarshaler or json.Marshaler, such as
+// encoding/json and many structured loggers, encode it as its representation.
+//
+//	log.Info("request", "body", repr.NewValue(body))
+type Value struct {
+	v       any
+	options []Option
+}
+
+// NewValue returns a Value that encodes as the output of String(v, options...).
+func NewValue(v any, options ...Option) Value {
+	return Value{v: v, options: options}
+}
+
+// String returns the representation of the wrapped value.
+func (v Value) String() string { return String(v.v, v.options...) }
+
+// MarshalText implements encoding.TextMarshaler.
+func (v Value) MarshalText() ([]byte, error) { return []byte(v.String()), nil }
+
+// MarshalJSON implements json.Marshaler, encoding the representation as a JSON string.
+func (v Value) MarshalJSON() ([]byte, error) { return json.Marshal(v.String()) }
@@ -0,0 +1,79 @@
+package repr
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+)
+
+var debugValues = map[string]func() any{}
+
+// Register makes the value returned by getter available to DumpAll under name.
+//
+// Registering a name again replaces its getter, and a nil getter removes it.
+func Register(name string, getter func() any) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if getter == nil {
+		delete(debugValues, name)
+		return
+	}
+	debugValues[name] = getter
+}
+
+// DumpAll writes every registered value to w, sorted by name.
+//
+// Panics in getters or while rendering are reported in place of the value, so DumpAll is safe to call
+// from signal handlers and other last-resort diagnostics.
+func DumpAll(w io.Writer, options ...Option) {
+	registryLock.RLock()
+	names := make([]string, 0, len(debugValues))
+	getters := make(map[string]func() any, len(debugValues))
+	for name, getter := range debugValues {
+		names = append(names, name)
+		getters[name] = getter
+	}
+	// Getters may themselves register values, so don't hold the lock while calling them.
+	registryLock.RUnlock()
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s = %s\n", name, dumpValue(getters[name], options))
+	}
+}
+
+func dumpValue(getter func() any, options []Option) (s string) {
+	defer func() {
+		if r := recover(); r != nil {
+			s = fmt.Sprintf("<panic: %v>", r)
+		}
+	}()
+	return String(getter(), options...)
+}
+
+// DumpOnSignal calls DumpAll with w whenever sig is received, eg. syscall.SIGQUIT.
+//
+// The returned function stops dumping and restores the previous handling of sig.
+func DumpOnSignal(sig os.Signal, w io.Writer, options ...Option) (stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, sig)
+	done := dumpOnReceive(signals, w, options)
+	return func() {
+		signal.Stop(signals)
+		close(signals)
+		<-done
+	}
+}
+
+// Calls DumpAll for each value received on signals until it is closed, then closes the returned channel.
+func dumpOnReceive(signals chan os.Signal, w io.Writer, options []Option) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range signals {
+			DumpAll(w, options...)
+		}
+	}()
+	return done
+}
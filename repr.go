@@ -3,17 +3,30 @@
 //
 // Some values (such as pointers to basic types) can not be represented directly in
 // Go. These values will be output as `&<value>`. eg. `&23`
+//
+// Map keys are sorted byte-wise by their representation, independent of the locale, so output is
+// identical on every machine. Use NaturalSort or KeyCollation for more human-friendly orderings.
 package repr
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"html"
 	"io"
+	"math"
 	"os"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 	"unsafe"
 )
 
@@ -44,12 +57,116 @@ var (
 		reflect.String:     "string",
 	}
 
+	errorType      = reflect.TypeOf((*error)(nil)).Elem()
 	goStringerType = reflect.TypeOf((*fmt.GoStringer)(nil)).Elem()
+	stringerType   = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
 	anyType        = reflect.TypeOf((*any)(nil)).Elem()
 
 	byteSliceType = reflect.TypeOf([]byte{})
+	timeType      = reflect.TypeOf(time.Time{})
+	mutexType     = reflect.TypeOf(sync.Mutex{})
+	rwMutexType   = reflect.TypeOf(sync.RWMutex{})
+)
+
+var (
+	registryLock sync.RWMutex
+	// Renderers registered by fully-qualified type name.
+	namedRenderers = map[string]func(v reflect.Value) string{}
+	// Constructors registered by type.
+	constructors = map[reflect.Type]func(v reflect.Value) string{}
+	// Expressions registered by individual value, keyed by type.
+	valueExprs = map[reflect.Type]map[any]string{}
 )
 
+// RegisterConstructor registers fn to represent values of type T as a Go expression that constructs
+// the value, eg. `time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)`.
+//
+// fn is used wherever a value of type T is encountered, at any depth.
+func RegisterConstructor[T any](fn func(v T) string) {
+	rt := reflect.TypeOf((*T)(nil)).Elem()
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	constructors[rt] = func(v reflect.Value) string { return fn(v.Interface().(T)) }
+}
+
+// RegisterValue registers expr as the Go expression representing value, eg. `slog.LevelInfo`.
+//
+// Unlike String() methods, expr is expected to compile, which makes it suitable for enum-like
+// constants in generated code. Registered values take precedence over RegisterConstructor.
+func RegisterValue[T comparable](value T, expr string) {
+	rt := reflect.TypeOf((*T)(nil)).Elem()
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	exprs := valueExprs[rt]
+	if exprs == nil {
+		exprs = map[any]string{}
+		valueExprs[rt] = exprs
+	}
+	exprs[value] = expr
+}
+
+func constructor(v reflect.Value) func(v reflect.Value) string {
+	if !v.CanInterface() {
+		return nil
+	}
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	if exprs := valueExprs[v.Type()]; exprs != nil {
+		if expr, ok := lookupValue(exprs, v.Interface()); ok {
+			return func(reflect.Value) string { return expr }
+		}
+	}
+	return constructors[v.Type()]
+}
+
+// Returns the expression registered for value by RegisterValue. Values of comparable types can still
+// be unhashable, such as structs with interface fields holding slices, and these are never registered.
+func lookupValue(exprs map[any]string, value any) (expr string, ok bool) {
+	defer func() {
+		if recover() != nil {
+			expr, ok = "", false
+		}
+	}()
+	expr, ok = exprs[value]
+	return expr, ok
+}
+
+// RegisterTypeName registers fn to render values of the type with the given fully-qualified name,
+// eg. "github.com/google/uuid.UUID".
+//
+// Any vendor directory in the package path of a type is ignored when matching, so vendored copies of
+// the same type are also rendered by fn.
+func RegisterTypeName(name string, fn func(v reflect.Value) string) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	namedRenderers[name] = fn
+}
+
+func namedRenderer(t reflect.Type) func(v reflect.Value) string {
+	name := qualifiedTypeName(t)
+	if name == "" {
+		return nil
+	}
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	return namedRenderers[name]
+}
+
+// Returns the fully-qualified name of t, with any vendor directory stripped, or "" if t is not a named type.
+func qualifiedTypeName(t reflect.Type) string {
+	if t.Name() == "" || t.PkgPath() == "" {
+		return ""
+	}
+	return stripVendor(t.PkgPath()) + "." + t.Name()
+}
+
+func stripVendor(pkg string) string {
+	if i := strings.LastIndex(pkg, "/vendor/"); i >= 0 {
+		return pkg[i+len("/vendor/"):]
+	}
+	return strings.TrimPrefix(pkg, "vendor/")
+}
+
 // Default prints to os.Stdout with two space indentation.
 var Default = New(os.Stdout, Indent("  "))
 
@@ -57,20 +174,37 @@ var Default = New(os.Stdout, Indent("  "))
 type Option func(o *Printer)
 
 // Indent output by this much.
-func Indent(indent string) Option { return func(o *Printer) { o.indent = indent } }
+func Indent(indent string) Option { return func(o *Printer) { o.indent, o.indentFunc = indent, nil } }
+
+// IndentFunc indents each level of nesting with the string returned by fn, where the contents of
+// the top-level value are at level 1.
+func IndentFunc(fn func(level int) string) Option {
+	return func(o *Printer) { o.indent, o.indentFunc = fn(1), fn }
+}
 
 // NoIndent disables indenting.
-func NoIndent() Option { return Indent("") }
+func NoIndent() Option { return func(o *Printer) { o.indent, o.indentFunc = "", nil } }
 
 // OmitEmpty sets whether empty field members should be omitted from output.
 func OmitEmpty(omitEmpty bool) Option { return func(o *Printer) { o.omitEmpty = omitEmpty } }
 
+// EmptyPlaceholder prints placeholder in place of top-level values that are empty or zero, such as
+// `T{}`. An empty placeholder prints nothing at all.
+func EmptyPlaceholder(placeholder string) Option {
+	return func(o *Printer) { o.omitTopLevel, o.emptyPlaceholder = true, placeholder }
+}
+
 // ExplicitTypes adds explicit typing to slice and map struct values that would normally be inferred by Go.
 func ExplicitTypes(ok bool) Option { return func(o *Printer) { o.explicitTypes = true } }
 
 // IgnoreGoStringer disables use of the .GoString() method.
 func IgnoreGoStringer() Option { return func(o *Printer) { o.ignoreGoStringer = true } }
 
+// ValidateGoString only uses the result of a .GoString() method if it parses as a Go expression.
+// Otherwise the value is printed as if it had no GoString() method, and the result is reported to
+// OnWarning.
+func ValidateGoString() Option { return func(o *Printer) { o.validateGoString = true } }
+
 // IgnorePrivate disables private field members from output.
 func IgnorePrivate() Option { return func(o *Printer) { o.ignorePrivate = true } }
 
@@ -88,37 +222,595 @@ func Hide[T any]() Option {
 	}
 }
 
+// HideImplementing excludes fields whose type implements the interface I from representation.
+func HideImplementing[I any]() Option {
+	rt := reflect.TypeOf((*I)(nil)).Elem()
+	if rt.Kind() != reflect.Interface {
+		panic("repr: HideImplementing requires an interface type, not " + rt.String())
+	}
+	return func(o *Printer) { o.hiddenInterfaces = append(o.hiddenInterfaces, rt) }
+}
+
+// HideGeneric excludes fields of any instantiation of the named generic type from representation.
+//
+// The name may be qualified by package name or import path, eg. "cache.Cache" or
+// "example.com/cache.Cache", and matches "cache.Cache[string]", "cache.Cache[int]", etc.
+func HideGeneric(name string) Option {
+	return func(o *Printer) { o.hiddenGenerics[name] = true }
+}
+
+// Summarize renders values of type T as their type followed by a one line summary returned by fn, eg.
+// `*sql.DB /* open, 12 conns */`.
+//
+// In StrictGo mode the summary follows the zero value of T instead.
+func Summarize[T any](fn func(T) string) Option {
+	rt := reflect.TypeOf((*T)(nil)).Elem()
+	return func(o *Printer) {
+		o.summaries[rt] = func(v reflect.Value) string { return fn(v.Interface().(T)) }
+	}
+}
+
+// KindFormatter renders all values of the given kind with fn, eg. to print every float64 with two
+// decimal places.
+//
+// Registered constructors and renderers, and GoString() methods, take precedence.
+func KindFormatter(kind reflect.Kind, fn func(v reflect.Value) string) Option {
+	return func(o *Printer) { o.kindFormatters[kind] = fn }
+}
+
 // AlwaysIncludeType always includes explicit type information for each item.
 func AlwaysIncludeType() Option { return func(o *Printer) { o.alwaysIncludeType = true } }
 
+// IndexComments annotates every nth element of slices and arrays with a comment containing its index,
+// eg. `/* [128] */`.
+func IndexComments(every int) Option { return func(o *Printer) { o.indexComments = every } }
+
+// ParenthesizeNegative wraps negative scalars that aren't already wrapped in a type conversion in
+// parentheses, eg. `(-5)`, so they can be safely pasted into arithmetic expressions.
+//
+// Negative values of named types, such as time.Duration, are always wrapped in a type conversion.
+func ParenthesizeNegative() Option { return func(o *Printer) { o.parenNegative = true } }
+
+// ZeroUintptrs prints all uintptr and unsafe.Pointer values as zero, for deterministic output.
+func ZeroUintptrs() Option { return func(o *Printer) { o.zeroUintptrs = true } }
+
+// Deterministic strips all nondeterministic content from the output, so that the same value is always
+// represented identically across runs.
+//
+// uintptr and unsafe.Pointer values are zeroed, channel capacities are omitted, and map keys are
+// sorted by their representation rather than by address. The monotonic clock reading of time.Time
+// values is never included. Pointers shown by ShowAddresses are given IDs, as with StableAddresses.
+func Deterministic() Option {
+	return func(o *Printer) {
+		o.deterministic = true
+		o.zeroUintptrs = true
+	}
+}
+
+// LoadLocations represents time.Time values in named IANA zones, such as "Europe/Berlin", by loading the
+// zone with time.LoadLocation rather than with time.FixedZone, preserving daylight saving behaviour.
+func LoadLocations() Option { return func(o *Printer) { o.loadLocations = true } }
+
+// HideFuncs excludes struct fields and map entries containing funcs from output. Other funcs, such as
+// slice elements, are printed as nil.
+//
+// In StrictGo mode, funcs are always printed as nil followed by a comment, as they can not be
+// represented.
+func HideFuncs() Option { return func(o *Printer) { o.hideFuncs = true } }
+
+// ChanPolicy controls how channels are represented.
+type ChanPolicy int
+
+const (
+	// ChanMake represents channels with make(), including their capacity. This is the default.
+	ChanMake ChanPolicy = iota
+	// ChanNil represents channels as nil.
+	ChanNil
+	// ChanOmit excludes struct fields and map entries containing channels from output. Other
+	// channels, such as slice elements, are represented as nil.
+	ChanOmit
+)
+
+// Channels sets the policy for representing channels.
+func Channels(policy ChanPolicy) Option { return func(o *Printer) { o.chanPolicy = policy } }
+
+// ChanInfo follows channels represented with make() by a comment containing the size of their
+// element type and their direction, eg. `/* elem size=24B, dir=recv */`.
+func ChanInfo() Option { return func(o *Printer) { o.chanInfo = true } }
+
+// BytesFormat controls how []byte values are represented.
+type BytesFormat int
+
+const (
+	// BytesAuto represents []byte values that contain printable UTF-8 text as strings, and others in
+	// hex. This is the default. Before layout version 4 it represents all []byte values as strings.
+	BytesAuto BytesFormat = iota
+	// BytesString represents []byte values as strings, eg. `[]byte("abc")`.
+	BytesString
+	// BytesHex represents []byte values as hex literals, eg. `[]byte{0x61, 0x62, 0x63}`.
+	BytesHex
+)
+
+// Bytes sets the format for representing []byte values.
+func Bytes(format BytesFormat) Option { return func(o *Printer) { o.bytesFormat = format } }
+
+// OmitNil omits struct fields containing nil pointers, interfaces, maps, slices, channels or funcs,
+// while keeping zero scalars and empty but non-nil collections.
+//
+// OmitNil replaces OmitEmpty, which is disabled.
+func OmitNil() Option {
+	return func(o *Printer) {
+		o.omitNil = true
+		o.omitEmpty = false
+	}
+}
+
+// NilAsEmpty represents nil slices and maps as empty, eg. `[]int{}`, rather than nil.
+func NilAsEmpty() Option { return func(o *Printer) { o.nilAsEmpty = true } }
+
+// EmptyAsNil represents empty slices and maps as nil, rather than eg. `[]int{}`.
+func EmptyAsNil() Option { return func(o *Printer) { o.emptyAsNil = true } }
+
+// PreserveCapacity represents slices with a capacity more than twice their length so that the
+// capacity is preserved, eg. `append(make([]int, 0, 64), []int{1, 2}...)`.
+func PreserveCapacity() Option { return func(o *Printer) { o.preserveCapacity = true } }
+
+// SortSlices sorts the elements of slices and arrays with less before printing them. The values
+// themselves are not modified.
+//
+// This is useful for stable output when the order of elements is not meaningful.
+func SortSlices(less func(a, b reflect.Value) bool) Option {
+	return func(o *Printer) { o.sortSlices = less }
+}
+
+// UseJSONNames displays struct fields using the names from their json tags. Fields tagged with `json:"-"`
+// are excluded.
+func UseJSONNames() Option { return func(o *Printer) { o.useJSONNames = true } }
+
+// HideField excludes struct fields with the given names from output. Names may be either Go field
+// names or json tag names.
+func HideField(names ...string) Option {
+	return func(o *Printer) {
+		for _, name := range names {
+			o.hiddenFields[name] = true
+		}
+	}
+}
+
+// FieldBudget truncates the values of struct fields with the given name, which may be either a Go
+// field name or a json tag name, to at most n bytes for strings and []byte, or n elements for other
+// slices. A comment records how much was removed.
+//
+// This keeps output readable when a few known fields, such as raw message bodies, are huge.
+func FieldBudget(name string, n int) Option {
+	return func(o *Printer) { o.fieldBudgets[name] = n }
+}
+
+// Canonical produces a stable normal form of values, suitable for hashing, caching and equality
+// comparisons.
+//
+// It implies Deterministic, and additionally sorts the elements of slices and arrays by their
+// representation. Use Normalize to obtain the normalized value itself.
+func Canonical() Option {
+	return func(o *Printer) {
+		Deterministic()(o)
+		o.canonical = true
+	}
+}
+
+// Prefix prefixes every line of output after the first with prefix, so that output can be embedded in
+// other indented text, such as the body of a generated function.
+func Prefix(prefix string) Option { return func(o *Printer) { o.prefix = prefix } }
+
+// Provenance adds a comment block to generated Go files, recording the type and package of the
+// value, the version of repr, and the options used.
+func Provenance() Option { return func(o *Printer) { o.provenance = true } }
+
+// BuildConstraint adds a "//go:build" line with the given expression to generated Go files.
+func BuildConstraint(expr string) Option { return func(o *Printer) { o.buildConstraint = expr } }
+
+// TestFile makes WriteFixtureFile write to a "_test.go" file, so the fixture is only compiled
+// into tests.
+func TestFile() Option { return func(o *Printer) { o.testFile = true } }
+
+// OnWarning calls fn whenever part of a value is rendered lossily or as something that is not
+// valid Go, with the path to the value, eg. "Field[0]", and the reason.
+func OnWarning(fn func(path, reason string)) Option {
+	return func(o *Printer) { o.onWarning = fn }
+}
+
+// SortFields prints struct fields sorted by name rather than in declaration order.
+//
+// This keeps the output of different versions of a struct aligned when diffed, so that only
+// fields that were added, removed or changed show up.
+func SortFields() Option { return func(o *Printer) { o.sortFields = true } }
+
+// ShowAddresses precedes each non-nil pointer with a comment containing its address, so that
+// pointers to the same value can be identified.
+func ShowAddresses() Option { return func(o *Printer) { o.showAddresses = true } }
+
+// StableAddresses implies ShowAddresses, but replaces addresses with IDs, eg. `/* p1 */`, assigned in
+// the order pointers are printed. Pointers to the same value share an ID, so output shows which
+// values are shared while remaining the same across runs.
+func StableAddresses() Option {
+	return func(o *Printer) {
+		o.showAddresses = true
+		o.stableAddresses = true
+	}
+}
+
+// UnrollCycles prints values that refer back to themselves up to n more times before printing a
+// cycle marker, eg. to show the neighbours of nodes in a doubly linked list.
+func UnrollCycles(n int) Option { return func(o *Printer) { o.unrollCycles = n } }
+
+// NaturalSort sorts map keys with runs of digits compared numerically, so that "item2" sorts
+// before "item10".
+func NaturalSort() Option { return func(o *Printer) { o.naturalSort = true } }
+
+// KeyCollation sorts map keys with compare, which returns a negative number, zero or a positive
+// number when a sorts before, the same as or after b. Keys that compare the same fall back to
+// byte-wise order, so output remains stable.
+//
+// This allows Unicode collation to be used for keys in non-Latin scripts, eg.
+//
+//	repr.KeyCollation(collate.New(language.Und).CompareString)
+func KeyCollation(compare func(a, b string) int) Option {
+	return func(o *Printer) { o.keyCollation = compare }
+}
+
+// Snapshot deep copies values before printing them, so that values mutated concurrently are not
+// rendered part way through a change.
+//
+// If lock is not nil it is held while copying, but not while rendering, which is usually much slower.
+// Without a lock copying still races with writers, but over a much shorter window.
+func Snapshot(lock sync.Locker) Option {
+	return func(o *Printer) { o.snapshot, o.snapshotLock = true, lock }
+}
+
+// LockStructs holds the lock of structs that embed a sync.Mutex or sync.RWMutex while printing them,
+// or prints the result of their Snapshot() method if they have one. The embedded lock itself is not
+// printed. Lock() methods of other types are never called.
+//
+// A struct that is already locked by the caller will deadlock.
+func LockStructs() Option { return func(o *Printer) { o.lockStructs = true } }
+
+// Resolve calls fn for values with a Load() or Get() method, such as lazily computed values and
+// futures. If fn returns true the value it returns is printed in place of the original.
+//
+// LazyValue is a resolver for the common forms of these methods.
+func Resolve(fn func(v any) (any, bool)) Option { return func(o *Printer) { o.resolve = fn } }
+
+// Shallow prints only the immediate contents of the top-level value, with nested structs, slices,
+// arrays and maps abbreviated to their type, eg. `Inner: mypkg.Inner{...}`.
+func Shallow() Option { return func(o *Printer) { o.shallow = true } }
+
+// MaxDepth prints structs, slices, arrays and maps nested more than n deep as a placeholder, eg.
+// `Next: &ast.Node{/* truncated */}`. Truncated values are reported to OnWarning, or as errors by
+// Safe and PrintStrict in StrictGo mode.
+func MaxDepth(n int) Option { return func(o *Printer) { o.maxDepth = n } }
+
+// ShowMethods follows top-level values with a comment listing the exported methods of their type,
+// eg. `/* methods: Close, Read, Write */`.
+func ShowMethods() Option { return func(o *Printer) { o.showMethods = true } }
+
+// SizeComments annotates structs, slices, arrays and maps with the approximate memory used by them
+// and the values they reference, eg. `/* ~48KB */`.
+//
+// Only values that are printed are counted, so hidden fields and values rendered by constructors or
+// GoString() methods are not included.
+func SizeComments() Option { return func(o *Printer) { o.sizeComments = true } }
+
+// ShowLayout annotates struct fields with their offset, size and alignment, and the padding that
+// follows them, eg. `A: 1 /* off=0 size=1 align=1 pad=7 */`.
+func ShowLayout() Option { return func(o *Printer) { o.showLayout = true } }
+
+// Consts makes GoFile and GoVars declare values that can be represented as constant expressions,
+// such as numbers and strings, with const rather than var.
+func Consts() Option { return func(o *Printer) { o.consts = true } }
+
+// InternStrings makes GoFile and GoVars declare string literals of at least minLen bytes that occur
+// more than once as constants, referenced by name wherever they occur.
+func InternStrings(minLen int) Option { return func(o *Printer) { o.internStrings = minLen } }
+
+// DedupSubtrees makes GoFile and GoVars declare structs, slices, arrays and maps that occur more than
+// once, and whose single line representation is at least minLen bytes, as variables referenced by
+// name wherever they occur.
+//
+// Note that slices and maps referenced from more than one place share their contents.
+func DedupSubtrees(minLen int) Option { return func(o *Printer) { o.dedupSubtrees = minLen } }
+
+// DiffFriendly lays out values so that changing, adding or removing one element changes one line of
+// output: every element is on its own line with a trailing comma, and struct fields and map keys are
+// sorted. It implies Deterministic and SortFields, and indents with two spaces unless Indent is set.
+func DiffFriendly() Option {
+	return func(o *Printer) {
+		Deterministic()(o)
+		o.sortFields = true
+		o.diffFriendly = true
+		if o.indent == "" {
+			o.indent = "  "
+		}
+	}
+}
+
+// LatestLayout is the most recent layout version supported by LayoutVersion.
+const LatestLayout = 6
+
+// LayoutVersion selects the version of the output layout. Output for a given version will not change,
+// so golden files remain valid; changes to the layout are only made available through new versions.
+//
+// The default is version 1. The changes in each version are:
+//
+//	2: Structs ending in a private field hidden by IgnorePrivate have a trailing comma and newline
+//	   after their last field when indented.
+//	3: Cycles are marked with the path of the value they cycle back to, eg. `/* cycle to <root> */`,
+//	   in place of the pointer rather than as `&...`, and as `nil /* cycle to <root> */` in StrictGo
+//	   mode rather than `nil /* cycle */`. Canonical sorts by these markers.
+//	4: []byte values that aren't printable text are printed in hex by default, eg. `[]byte{0xff}`,
+//	   rather than as strings. See Bytes.
+//	5: Keys of maps with interface keys are sorted by their dynamic type first, so that keys with the
+//	   same representation, such as 1 and "1", are printed in a stable order.
+//	6: Iterators truncated by MaterializeIterators are marked with the Truncated marker, eg.
+//	   `/* truncated */`, rather than `/* more elided */`.
+func LayoutVersion(version int) Option { return func(o *Printer) { o.layoutVersion = version } }
+
+// MaxWidth prints structs, slices, arrays and maps on one line if they fit within width columns,
+// and otherwise over multiple lines with each element checked in turn. It has no effect if
+// indentation is disabled.
+func MaxWidth(width int) Option { return func(o *Printer) { o.maxWidth = width } }
+
+// GroupKeys nests the entries of maps with string keys that share a prefix ending in sep, eg. "db.host"
+// and "db.port" are printed within a `"db.": {...}` entry. The output is not valid Go.
+func GroupKeys(sep string) Option { return func(o *Printer) { o.groupKeys = sep } }
+
+// AutoFlush flushes the writer after each top-level value is printed, if it has a Flush() or
+// Flush() error method, such as bufio.Writer and http.Flusher.
+func AutoFlush() Option { return func(o *Printer) { o.autoFlush = true } }
+
+// Caption sets the caption preceding the code block returned by Markdown.
+func Caption(caption string) Option { return func(o *Printer) { o.caption = caption } }
+
+// ForceColor colours output with ANSI escape codes, even if it is not written to a terminal.
+func ForceColor() Option { return func(o *Printer) { o.colorMode = colorAlways } }
+
+// AutoColor colours output with ANSI escape codes if it is written to a terminal, and the NO_COLOR
+// environment variable is not set.
+func AutoColor() Option { return func(o *Printer) { o.colorMode = colorAuto } }
+
+// Colors sets the theme used for coloured output. It does not enable colour.
+func Colors(theme Theme) Option { return func(o *Printer) { o.theme = theme } }
+
+// NoColor disables colouring of output. This is the default.
+func NoColor() Option { return func(o *Printer) { o.colorMode = colorNever } }
+
+// Separator sets the separator printed between multiple values passed to Print and Println.
+//
+// The default is a single space.
+func Separator(separator string) Option { return func(o *Printer) { o.separator = separator } }
+
+// RecordSeparator sets the separator printed between the records written by PrintSlice.
+func RecordSeparator(separator string) Option {
+	return func(o *Printer) { o.recordSeparator = separator }
+}
+
+// StrictGo restricts output to valid Go expressions wherever possible.
+//
+// Scalars are printed as literals, pointers to values other than composite literals (such as scalars
+// or other pointers) are constructed with new() or a function literal, and values that can not be
+// represented (such as cycles, or values of unexported types stored in interfaces) are printed as nil
+// followed by a comment.
+func StrictGo() Option { return func(o *Printer) { o.strictGo = true } }
+
+// Markers sets the text of the placeholders that mark values that were not printed in full. Other
+// than Elided, they are printed as comments.
+type Markers struct {
+	// Cycle precedes the path of the value that a reference cycles back to, from layout version 3.
+	Cycle string
+	// Truncated marks values cut short by MaxDepth, and from layout version 6 by MaterializeIterators.
+	Truncated string
+	// More precedes the number of elements or bytes cut by FieldBudget, eg. `/* 2 more bytes */`.
+	More string
+	// Elided replaces the contents of values nested in the top-level value in Shallow mode, eg.
+	// `mypkg.Inner{...}`.
+	Elided string
+	// Func marks funcs, which can't be represented in StrictGo mode.
+	Func string
+	// Invalid marks values that no longer exist, such as map entries deleted while being printed.
+	Invalid string
+	// Unexported describes values of unexported types, which can't be represented in StrictGo mode.
+	Unexported string
+	// Hidden marks fields hidden by Hide, HideField, HideImplementing and HideGeneric. If empty, the
+	// default, hidden fields are omitted. Hidden fields are always omitted in StrictGo mode.
+	Hidden string
+}
+
+// DefaultMarkers are the markers used unless the UseMarkers option is given.
+var DefaultMarkers = Markers{
+	Cycle:      "cycle to",
+	Truncated:  "truncated",
+	More:       "more",
+	Elided:     "...",
+	Func:       "func elided",
+	Invalid:    "invalid",
+	Unexported: "unexported",
+}
+
+// UseMarkers sets the text of the comments that mark values that were not printed in full. Empty
+// markers, other than Hidden, are taken from DefaultMarkers.
+//
+// A Cycle marker given here is used at every LayoutVersion, whereas the default marker is only used
+// from version 3.
+func UseMarkers(markers Markers) Option {
+	explicitCycle := markers.Cycle != ""
+	return func(o *Printer) {
+		o.explicitCycle = explicitCycle
+		if markers.Cycle == "" {
+			markers.Cycle = DefaultMarkers.Cycle
+		}
+		if markers.Truncated == "" {
+			markers.Truncated = DefaultMarkers.Truncated
+		}
+		if markers.More == "" {
+			markers.More = DefaultMarkers.More
+		}
+		if markers.Elided == "" {
+			markers.Elided = DefaultMarkers.Elided
+		}
+		if markers.Func == "" {
+			markers.Func = DefaultMarkers.Func
+		}
+		if markers.Invalid == "" {
+			markers.Invalid = DefaultMarkers.Invalid
+		}
+		if markers.Unexported == "" {
+			markers.Unexported = DefaultMarkers.Unexported
+		}
+		o.markers = markers
+	}
+}
+
 // Printer represents structs in a printable manner.
 type Printer struct {
 	indent            string
 	omitEmpty         bool
+	omitTopLevel      bool
+	emptyPlaceholder  string
 	ignoreGoStringer  bool
+	validateGoString  bool
 	ignorePrivate     bool
 	alwaysIncludeType bool
 	explicitTypes     bool
 	exclude           map[reflect.Type]bool
 	w                 io.Writer
 	useLiterals       bool
+	strictGo          bool
+	indexComments     int
+	parenNegative     bool
+	zeroUintptrs      bool
+	deterministic     bool
+	canonical         bool
+	prefix            string
+	provenance        bool
+	buildConstraint   string
+	testFile          bool
+	consts            bool
+	internStrings     int
+	dedupSubtrees     int
+	diffFriendly      bool
+	layoutVersion     int
+	maxWidth          int
+	indentFunc        func(level int) string
+	groupKeys         string
+	autoFlush         bool
+	caption           string
+	colorMode         colorMode
+	colored           bool
+	html              bool // Whether output is HTML, escaped by an htmlWriter.
+	format            OutputFormat
+	jsonMapEntries    bool
+	theme             Theme
+	flatten           bool
+	flatEntries       *[]flatEntry // Lines collected instead of printed by Flatten, for Diff.
+	bareKeys          bool
+	gutter            GutterMode
+	gutterW           *gutterWriter // Writer holding lines until their gutter is known.
+	typeSource        bool
+	types             *typeSet    // Types printed, for TypeSource.
+	out               io.Writer   // The writer passed to New, before any wrapping.
+	outLock           *sync.Mutex // Serialises printing to the writers added by writingTo, which hold state between calls.
+	hoist             *hoister    // Values hoisted into their own declarations by GoVars.
+	loadLocations     bool
+	hideFuncs         bool
+	chanPolicy        ChanPolicy
+	bytesFormat       BytesFormat
+	chanInfo          bool
+	maxIterations     int
+	useJSONNames      bool
+	omitNil           bool
+	nilAsEmpty        bool
+	emptyAsNil        bool
+	sortSlices        func(a, b reflect.Value) bool
+	hiddenFields      map[string]bool
+	fieldBudgets      map[string]int
+	decodeFilter      func(field reflect.StructField) bool
+	decoders          []Decoder
+	hiddenGenerics    map[string]bool
+	hiddenInterfaces  []reflect.Type
+	summaries         map[reflect.Type]func(v reflect.Value) string
+	kindFormatters    map[reflect.Kind]func(v reflect.Value) string
+	shallow           bool
+	maxDepth          int
+	preserveCapacity  bool
+	markers           Markers
+	explicitCycle     bool // Markers.Cycle was given by UseMarkers.
+	showMethods       bool
+	sizeComments      bool
+	showLayout        bool
+	size              uint64 // Approximate memory used by values printed so far, for sizeComments.
+	depth             int    // Number of composite values currently being printed.
+	ancestors         []ancestor
+	unrollCycles      int
+	showAddresses     bool
+	stableAddresses   bool
+	pointerIDs        map[cloneKey]int // Pseudo-addresses assigned while printing with StableAddresses or Deterministic.
+	separator         string
+	recordSeparator   string
+	degraded          func(path, reason string)
+	onType            func(t reflect.Type)
+	localPkg          string     // Name of the package that GoVars generates code in.
+	imports           *importSet // Packages imported by the file that GoVars generates.
+	onWarning         func(path, reason string)
+	sortFields        bool
+	naturalSort       bool
+	keyCollation      func(a, b string) int
+	snapshot          bool
+	snapshotLock      sync.Locker
+	lockStructs       bool
+	heldLocks         map[cloneKey]int // Index of the lock field of structs that are locked while printing.
+	resolve           func(v any) (any, bool)
 }
 
 // New creates a new Printer on w with the given Options.
 func New(w io.Writer, options ...Option) *Printer {
 	p := &Printer{
-		w:         w,
-		indent:    "  ",
-		omitEmpty: true,
-		exclude:   map[reflect.Type]bool{},
+		w:               w,
+		indent:          "  ",
+		omitEmpty:       true,
+		exclude:         map[reflect.Type]bool{},
+		hiddenFields:    map[string]bool{},
+		fieldBudgets:    map[string]int{},
+		hiddenGenerics:  map[string]bool{},
+		summaries:       map[reflect.Type]func(v reflect.Value) string{},
+		kindFormatters:  map[reflect.Kind]func(v reflect.Value) string{},
+		separator:       " ",
+		layoutVersion:   1,
+		theme:           DefaultTheme,
+		markers:         DefaultMarkers,
+		recordSeparator: "---",
 	}
 	for _, option := range options {
 		option(p)
 	}
-	return p
+	return p.writingTo(w)
+}
+
+// Returns the value to print for v, taking a snapshot of it if required.
+func (p *Printer) valueOf(v any) reflect.Value {
+	if !p.snapshot {
+		return reflect.ValueOf(v)
+	}
+	if p.snapshotLock != nil {
+		p.snapshotLock.Lock()
+		defer p.snapshotLock.Unlock()
+	}
+	c := &cloner{p: p, seen: map[cloneKey]reflect.Value{}, path: map[reflect.Value]bool{}}
+	return c.clone(reflect.ValueOf(v))
 }
 
 func (p *Printer) nextIndent(indent string) string {
+	if p.indentFunc != nil && p.indent != "" {
+		return indent + p.indentFunc(p.depth)
+	}
 	if p.indent != "" {
 		return indent + p.indent
 	}
@@ -134,221 +826,1778 @@ func (p *Printer) thisIndent(indent string) string {
 
 // Print the values.
 func (p *Printer) Print(vs ...any) {
+	p.outLock.Lock()
+	defer p.outLock.Unlock()
 	for i, v := range vs {
 		if i > 0 {
-			fmt.Fprint(p.w, " ")
+			fmt.Fprint(p.w, p.separator)
 		}
-		p.reprValue(map[reflect.Value]bool{}, reflect.ValueOf(v), "", true, false)
+		p.printTop(p.valueOf(v))
 	}
 }
 
 // Println prints each value on a new line.
 func (p *Printer) Println(vs ...any) {
+	p.outLock.Lock()
+	defer p.outLock.Unlock()
 	for i, v := range vs {
 		if i > 0 {
-			fmt.Fprint(p.w, " ")
+			fmt.Fprint(p.w, p.separator)
 		}
-		p.reprValue(map[reflect.Value]bool{}, reflect.ValueOf(v), "", true, false)
+		p.printTop(p.valueOf(v))
 	}
 	fmt.Fprintln(p.w)
+	p.flush()
 }
 
-// showType is true if struct types should be shown. isAnyValue is true if the containing value is an "any" type.
-func (p *Printer) reprValue(seen map[reflect.Value]bool, v reflect.Value, indent string, showStructType bool, isAnyValue bool) { // nolint: gocyclo
-	if seen[v] {
-		fmt.Fprint(p.w, "...")
-		return
+// Sprint returns the output of Print.
+func (p *Printer) Sprint(vs ...any) string {
+	w := &strings.Builder{}
+	p.writingTo(w).Print(vs...)
+	return w.String()
+}
+
+// Sprintln returns the output of Println.
+func (p *Printer) Sprintln(vs ...any) string {
+	w := &strings.Builder{}
+	p.writingTo(w).Println(vs...)
+	return w.String()
+}
+
+// Sprintf formats according to a format specifier like fmt.Sprintf, with the additional verb %r
+// replaced by the representation of the corresponding argument.
+func (p *Printer) Sprintf(format string, args ...any) string {
+	wrapped := make([]any, len(args))
+	copy(wrapped, args)
+	for i := range reprArgs(format) {
+		if i < len(args) {
+			wrapped[i] = formatter{p: p, v: args[i]}
+		}
 	}
-	seen[v] = true
-	defer delete(seen, v)
+	return fmt.Sprintf(format, wrapped...)
+}
 
-	if v.Kind() == reflect.Invalid || (v.Kind() == reflect.Ptr || v.Kind() == reflect.Map || v.Kind() == reflect.Chan || v.Kind() == reflect.Slice || v.Kind() == reflect.Func || v.Kind() == reflect.Interface) && v.IsNil() {
-		fmt.Fprint(p.w, "nil")
-		return
+// Returns the indexes of the arguments formatted with %r by format.
+func reprArgs(format string) map[int]bool {
+	indexes := map[int]bool{}
+	arg := 0
+	// Parses an explicit argument index, eg. "[2]".
+	explicit := func(i int) int {
+		if i < len(format) && format[i] == '[' {
+			if end := strings.IndexByte(format[i:], ']'); end > 0 {
+				if n, err := strconv.Atoi(format[i+1 : i+end]); err == nil {
+					arg = n - 1
+				}
+				return i + end + 1
+			}
+		}
+		return i
 	}
-	t := v.Type()
+	// Skips a width or precision, which may be taken from an argument.
+	number := func(i int) int {
+		i = explicit(i)
+		if i < len(format) && format[i] == '*' {
+			arg++
+			return i + 1
+		}
+		for i < len(format) && format[i] >= '0' && format[i] <= '9' {
+			i++
+		}
+		return i
+	}
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		for i < len(format) && strings.IndexByte("+-# 0", format[i]) >= 0 {
+			i++
+		}
+		i = number(i)
+		if i < len(format) && format[i] == '.' {
+			i = number(i + 1)
+		}
+		i = explicit(i)
+		if i >= len(format) || format[i] == '%' {
+			continue
+		}
+		if format[i] == 'r' {
+			indexes[arg] = true
+		}
+		arg++
+	}
+	return indexes
+}
 
-	if t == byteSliceType {
-		fmt.Fprintf(p.w, "[]byte(%q)", v.Bytes())
-		return
+// Returns a copy of p writing to w.
+func (p *Printer) writingTo(w io.Writer) *Printer {
+	c := *p
+	c.w = w
+	c.out = w
+	c.outLock = &sync.Mutex{}
+	c.colored = c.html || c.colorMode == colorAlways || c.colorMode == colorAuto && os.Getenv("NO_COLOR") == "" && isTerminal(w)
+	if c.gutter != GutterNone {
+		c.gutterW = &gutterWriter{w: c.w, mode: c.gutter, html: c.html}
+		c.w = c.gutterW
+	}
+	if c.prefix != "" {
+		prefix := c.prefix
+		if c.html {
+			prefix = html.EscapeString(prefix)
+		}
+		c.w = &prefixWriter{w: c.w, prefix: []byte(prefix)}
 	}
+	if c.maxWidth > 0 {
+		c.w = &columnWriter{w: c.w, html: c.html}
+	}
+	if c.html {
+		// Escape all text before it reaches the other writers, so that markup can be written beneath.
+		c.w = &htmlWriter{w: c.w}
+	}
+	return &c
+}
 
-	// If we can't access a private field directly with reflection, try and do so via unsafe.
-	if !v.CanInterface() && v.CanAddr() {
-		uv := reflect.NewAt(t, unsafe.Pointer(v.UnsafeAddr())).Elem()
-		if uv.CanInterface() {
-			v = uv
+// Formats %r as the representation of v, and other verbs as fmt does.
+type formatter struct {
+	p *Printer
+	v any
+}
+
+func (f formatter) Format(s fmt.State, verb rune) {
+	if verb == 'r' {
+		f.p.writingTo(s).Print(f.v)
+		return
+	}
+	format := "%"
+	for _, flag := range "+-# 0" {
+		if s.Flag(int(flag)) {
+			format += string(flag)
 		}
 	}
-	// Attempt to use fmt.GoStringer interface.
-	if !p.ignoreGoStringer && t.Implements(goStringerType) && v.CanInterface() {
-		fmt.Fprint(p.w, v.Interface().(fmt.GoStringer).GoString())
+	if width, ok := s.Width(); ok {
+		format += strconv.Itoa(width)
+	}
+	if precision, ok := s.Precision(); ok {
+		format += "." + strconv.Itoa(precision)
+	}
+	fmt.Fprintf(s, format+string(verb), f.v)
+}
+
+// PrintSlice prints each element of a slice or array as a separate top-level record, with records
+// separated by lines containing the record separator.
+//
+// Any other value is printed as a single record.
+func (p *Printer) PrintSlice(slice any) {
+	v := p.valueOf(slice)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		p.Println(slice)
 		return
 	}
-	in := p.thisIndent(indent)
-	ni := p.nextIndent(indent)
-	switch v.Kind() {
-	case reflect.Slice, reflect.Array:
-		fmt.Fprintf(p.w, "%s{", substAny(v.Type()))
-		if v.Len() == 0 {
-			fmt.Fprint(p.w, "}")
-		} else {
-			if p.indent != "" {
-				fmt.Fprintf(p.w, "\n")
-			}
-			for i := 0; i < v.Len(); i++ {
-				e := v.Index(i)
-				fmt.Fprintf(p.w, "%s", ni)
-				p.reprValue(seen, e, ni, p.alwaysIncludeType || p.explicitTypes, v.Type().Elem() == anyType)
-				if p.indent != "" {
-					fmt.Fprintf(p.w, ",\n")
-				} else if i < v.Len()-1 {
-					fmt.Fprintf(p.w, ", ")
-				}
-			}
-			fmt.Fprintf(p.w, "%s}", in)
+	p.outLock.Lock()
+	defer p.outLock.Unlock()
+	for i := 0; i < v.Len(); i++ {
+		if i > 0 {
+			fmt.Fprintf(p.w, "%s\n", p.recordSeparator)
 		}
+		p.printTop(v.Index(i))
+		fmt.Fprintln(p.w)
+		p.flush()
+	}
+}
 
-	case reflect.Chan:
-		fmt.Fprintf(p.w, "make(")
-		fmt.Fprintf(p.w, "%s", substAny(v.Type()))
-		fmt.Fprintf(p.w, ", %d)", v.Cap())
+// Prints a top-level value, with the lock on the output held.
+func (p *Printer) printTop(v reflect.Value) {
+	// Print with a copy, so that the state of printing one value is not shared with concurrent calls.
+	c := *p
+	func() {
+		defer c.buffer()()
+		c.printValue(v)
+	}()
+	c.flush()
+}
 
-	case reflect.Map:
-		fmt.Fprintf(p.w, "%s{", substAny(v.Type()))
-		if p.indent != "" && v.Len() != 0 {
-			fmt.Fprintf(p.w, "\n")
+func (p *Printer) printValue(v reflect.Value) {
+	if p.stableAddresses || p.deterministic && p.showAddresses {
+		p.pointerIDs = map[cloneKey]int{}
+		defer func() { p.pointerIDs = nil }()
+	}
+	if p.gutterW != nil {
+		p.gutterW.start()
+		defer func() { _ = p.gutterW.finish() }()
+	}
+	state := visitStates.Get().(*visitState)
+	p.ancestors = state.ancestors[:0]
+	defer func() {
+		for k := range state.seen {
+			delete(state.seen, k)
 		}
-		keys := v.MapKeys()
-		sort.Slice(keys, func(i, j int) bool {
-			return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
-		})
-		for i, k := range keys {
-			kv := v.MapIndex(k)
-			fmt.Fprintf(p.w, "%s", ni)
-			p.reprValue(seen, k, ni, p.alwaysIncludeType || p.explicitTypes, v.Type().Key() == anyType)
-			fmt.Fprintf(p.w, ": ")
-			p.reprValue(seen, kv, ni, true, v.Type().Elem() == anyType)
-			if p.indent != "" {
-				fmt.Fprintf(p.w, ",\n")
-			} else if i < v.Len()-1 {
-				fmt.Fprintf(p.w, ", ")
-			}
+		state.ancestors, p.ancestors = p.ancestors[:0], nil
+		visitStates.Put(state)
+	}()
+	if p.omitTopLevel && (!v.IsValid() || p.isEmpty(v)) {
+		fmt.Fprint(p.w, p.emptyPlaceholder)
+		return
+	}
+	if p.format == JSON {
+		p.printJSON(state.seen, v)
+		return
+	}
+	if p.flatten {
+		p.printFlattened(state.seen, "", v, false)
+		return
+	}
+	if p.typeSource {
+		p.types = &typeSet{seen: map[reflect.Type]bool{}}
+		defer func() {
+			p.writeTypeSources(p.types.types)
+			p.types = nil
+		}()
+	}
+	p.reprValue(state.seen, "", v, "", true, false)
+	if p.showMethods && v.IsValid() && v.Type().NumMethod() > 0 {
+		names := make([]string, v.Type().NumMethod())
+		for i := range names {
+			names[i] = v.Type().Method(i).Name
+		}
+		fmt.Fprint(p.w, " ")
+		p.writeComment("methods: " + strings.Join(names, ", "))
+	}
+}
+
+// Size of the buffer used when printing to writers that are not already buffered. Printing makes
+// many small writes, which are expensive for files and network connections.
+const printBufferSize = 4096
+
+var printBuffers = sync.Pool{New: func() any { return bufio.NewWriterSize(nil, printBufferSize) }}
+
+// Buffers writes to the output, if it is not already buffered, until the returned function is
+// called.
+func (p *Printer) buffer() (release func()) {
+	// Buffer beneath the writers added by writingTo, which may write their own output.
+	target := &p.w
+	if hw, ok := (*target).(*htmlWriter); ok {
+		target = &hw.w
+	}
+	if cw, ok := (*target).(*columnWriter); ok {
+		target = &cw.w
+	}
+	if pw, ok := (*target).(*prefixWriter); ok {
+		target = &pw.w
+	}
+	if gw, ok := (*target).(*gutterWriter); ok {
+		target = &gw.w
+	}
+	switch (*target).(type) {
+	case *bytes.Buffer, *strings.Builder, *bufio.Writer:
+		return func() {}
+	}
+	if *target == io.Discard {
+		return func() {}
+	}
+	w := *target
+	bw := printBuffers.Get().(*bufio.Writer)
+	bw.Reset(w)
+	*target = bw
+	return func() {
+		_ = bw.Flush()
+		bw.Reset(nil)
+		*target = w
+		printBuffers.Put(bw)
+	}
+}
+
+// Flushes the output if AutoFlush is set.
+func (p *Printer) flush() {
+	if !p.autoFlush {
+		return
+	}
+	switch w := p.out.(type) {
+	case interface{ Flush() error }:
+		_ = w.Flush()
+	case interface{ Flush() }:
+		w.Flush()
+	}
+}
+
+// path is the location of v within the top-level value, eg. ".Field[0]".
+//
+// showType is true if struct types should be shown. isAnyValue is true if the containing value is an
+// interface type, in which case the dynamic type of v is always included so that it can be rebuilt.
+func (p *Printer) reprValue(seen map[reflect.Value]bool, path string, v reflect.Value, indent string, showStructType bool, isAnyValue bool) { // nolint: gocyclo
+	// Only values that can contain other values can be part of a cycle, so scalars are not tracked.
+	if canCycle(v.Kind()) {
+		if p.isCycle(seen, v) {
+			if p.strictGo {
+				p.degrade(path, "cycle")
+				fmt.Fprint(p.w, "nil ")
+				p.writeComment(p.cycleTo(v))
+			} else if !p.cycleMarkers() {
+				p.warn(path, "cycle")
+				fmt.Fprint(p.w, "...")
+			} else {
+				p.warn(path, "cycle")
+				p.writeComment(p.cycleTo(v))
+			}
+			return
+		}
+		revisit := seen[v]
+		seen[v] = true
+		p.ancestors = append(p.ancestors, ancestor{v, path})
+		// v is replaced by an accessible copy below, so unmark the value that was marked.
+		defer func(v reflect.Value) {
+			if !revisit {
+				delete(seen, v)
+			}
+			p.ancestors = p.ancestors[:len(p.ancestors)-1]
+		}(v)
+	}
+
+	if v.Kind() == reflect.Invalid {
+		fmt.Fprint(p.w, "nil")
+		return
+	}
+	t := v.Type()
+	if p.onType != nil {
+		p.onType(t)
+	}
+	if p.types != nil {
+		p.types.add(t)
+	}
+	if isNil(v) {
+		switch {
+		case p.nilAsEmpty && (t.Kind() == reflect.Slice || t.Kind() == reflect.Map):
+			p.writeTypeName(t, indent)
+			fmt.Fprint(p.w, "{}")
+		case isAnyValue && t.Kind() != reflect.Interface:
+			// Keep the type of nil values stored in interfaces.
+			p.writeToken(typeToken, conversionType(formatTypeIn(t, p.thisIndent(indent), p.indent, p.imports)))
+			fmt.Fprint(p.w, "(nil)")
+		default:
+			fmt.Fprint(p.w, "nil")
+		}
+		return
+	}
+	sizeBefore := p.size
+	if p.sizeComments {
+		p.size += indirectSize(v)
+	}
+	if p.emptyAsNil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Map) && v.Len() == 0 {
+		if isAnyValue {
+			p.writeTypeName(t, indent)
+			fmt.Fprint(p.w, "(nil)")
+		} else {
+			fmt.Fprint(p.w, "nil")
+		}
+		return
+	}
+	if p.preserveCapacity && t.Kind() == reflect.Slice && !v.IsNil() && v.Cap() > 2*v.Len() {
+		if v.Len() == 0 {
+			fmt.Fprint(p.w, "make(")
+			p.writeTypeName(t, indent)
+			fmt.Fprintf(p.w, ", 0, %d)", v.Cap())
+			return
+		}
+		fmt.Fprint(p.w, "append(make(")
+		p.writeTypeName(t, indent)
+		fmt.Fprintf(p.w, ", 0, %d), ", v.Cap())
+		p.reprValue(seen, path, v.Slice3(0, v.Len(), v.Len()), indent, true, false)
+		fmt.Fprint(p.w, "...)")
+		return
+	}
+
+	if t == byteSliceType {
+		p.printBytes(v.Bytes())
+		return
+	}
+
+	v = accessible(v)
+	if p.resolve != nil {
+		if r, ok := p.resolved(v); ok {
+			p.reprValue(seen, path, r, indent, true, isAnyValue)
+			return
+		}
+	}
+	if summarize := p.summaries[t]; summarize != nil && v.CanInterface() {
+		if s, ok := p.safely(path, "summary of "+t.String(), func() string { return summarize(v) }); ok {
+			p.summary(path, t, indent, s)
+			return
+		}
+	}
+	if p.loadLocations && t == timeType && v.CanInterface() {
+		fmt.Fprint(p.w, formatTime(v.Interface().(time.Time), true))
+		return
+	}
+	// Use a registered constructor.
+	if construct := constructor(v); construct != nil {
+		if s, ok := p.safely(path, "constructor for "+t.String(), func() string { return construct(v) }); ok {
+			fmt.Fprint(p.w, s)
+			return
+		}
+	}
+	// Use a renderer registered by type name.
+	if render := namedRenderer(t); render != nil {
+		if s, ok := p.safely(path, "renderer for "+t.String(), func() string { return render(v) }); ok {
+			fmt.Fprint(p.w, s)
+			return
+		}
+	}
+	// Attempt to use fmt.GoStringer interface.
+	// In StrictGo mode pointers don't use their element's GoString(), as it drops the pointer.
+	if !p.ignoreGoStringer && t.Implements(goStringerType) && !(p.strictGo && t.Kind() == reflect.Ptr && t.Elem().Implements(goStringerType)) {
+		if !v.CanInterface() {
+			p.degrade(path, t.String()+".GoString() not called on inaccessible value")
+		} else if s, ok := p.safely(path, t.String()+".GoString()", func() string { return v.Interface().(fmt.GoStringer).GoString() }); ok {
+			if !p.validateGoString {
+				fmt.Fprint(p.w, s)
+				return
+			}
+			if _, err := parser.ParseExpr(s); err == nil {
+				fmt.Fprint(p.w, s)
+				return
+			}
+			p.warn(path, fmt.Sprintf("%s.GoString() returned invalid expression %q", t, s))
+		}
+	}
+	// time.Time has a GoString() method, so this is only reached if it is ignored or invalid.
+	if t == timeType && v.CanInterface() {
+		fmt.Fprint(p.w, timeToGo(v.Interface().(time.Time)))
+		return
+	}
+	if format := p.kindFormatters[v.Kind()]; format != nil {
+		if s, ok := p.safely(path, v.Kind().String()+" formatter", func() string { return format(v) }); ok {
+			fmt.Fprint(p.w, s)
+			return
+		}
+	}
+	switch v.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map:
+		if p.shallow && p.depth > 0 && !v.IsZero() && (v.Kind() == reflect.Struct || v.Len() > 0) {
+			p.writeTypeName(t, indent)
+			fmt.Fprintf(p.w, "{%s}", p.markers.Elided)
+			return
+		}
+		if p.maxDepth > 0 && p.depth >= p.maxDepth && !v.IsZero() && (v.Kind() == reflect.Struct || v.Len() > 0) {
+			if p.strictGo {
+				p.degrade(path, "truncated")
+			} else {
+				p.warn(path, "truncated")
+			}
+			p.writeTypeName(t, indent)
+			fmt.Fprint(p.w, "{")
+			p.writeComment(p.markers.Truncated)
+			fmt.Fprint(p.w, "}")
+			return
+		}
+		if p.strictGo && t.Name() == "" && (showStructType || v.Kind() != reflect.Struct) && p.unexportedIn(t) != nil {
+			p.unexportedValue(path, v)
+			return
+		}
+		if p.hoist != nil && p.dedupSubtrees > 0 && showStructType {
+			if name, ok := p.hoist.subtree(seen, path, v); ok {
+				fmt.Fprint(p.w, name)
+				return
+			}
+		}
+		if p.fitsOnLine(seen, v, showStructType, isAnyValue) {
+			// Print v again, now that it is known to fit, so degradations are reported.
+			delete(seen, v)
+			defer func() { seen[v] = true }()
+			oneLine := *p
+			oneLine.indent = ""
+			oneLine.reprValue(seen, path, v, "", showStructType, isAnyValue)
+			return
+		}
+		p.depth++
+		defer func() { p.depth-- }()
+		if p.sizeComments {
+			defer func() {
+				fmt.Fprint(p.w, " ")
+				p.writeComment("~" + formatSize(p.size-sizeBefore+uint64(t.Size())))
+			}()
+		}
+	}
+	in := p.thisIndent(indent)
+	ni := p.nextIndent(indent)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		multiline := p.indent != "" && v.Len() != 0
+		p.openComposite(v.Type(), indent, multiline)
+		if v.Len() == 0 {
+			fmt.Fprint(p.w, "}")
+		} else {
+			if p.indent != "" {
+				fmt.Fprintf(p.w, "\n")
+			}
+			order := p.sliceOrder(seen, v)
+			for i := 0; i < v.Len(); i++ {
+				e := v.Index(order[i])
+				ep := ""
+				if p.needsPath(e) {
+					ep = path + "[" + strconv.Itoa(order[i]) + "]"
+				}
+				p.markLine(ep)
+				fmt.Fprintf(p.w, "%s", ni)
+				if p.indexComments > 0 && i%p.indexComments == 0 {
+					p.writeComment(fmt.Sprintf("[%d]", i))
+					fmt.Fprint(p.w, " ")
+				}
+				p.reprValue(seen, ep, e, ni, p.alwaysIncludeType || p.explicitTypes, v.Type().Elem().Kind() == reflect.Interface)
+				if p.indent != "" {
+					fmt.Fprintf(p.w, ",\n")
+				} else if i < v.Len()-1 {
+					fmt.Fprintf(p.w, ", ")
+				}
+			}
+			p.markLine(path)
+			p.closeComposite(in, multiline)
+		}
+
+	case reflect.Chan:
+		if p.chanPolicy != ChanMake {
+			fmt.Fprint(p.w, "nil")
+			return
+		}
+		if v.Len() > 0 {
+			if p.strictGo {
+				p.degrade(path, "channel contents elided")
+			} else {
+				p.warn(path, "channel contents elided")
+			}
+		}
+		fmt.Fprintf(p.w, "make(")
+		p.writeTypeName(v.Type(), indent)
+		if p.deterministic {
+			fmt.Fprint(p.w, ")")
+		} else {
+			fmt.Fprintf(p.w, ", %d)", v.Cap())
+		}
+		if p.chanInfo {
+			fmt.Fprint(p.w, " ")
+			p.writeComment(chanInfo(t))
+		}
+
+	case reflect.Map:
+		keys := v.MapKeys()
+		p.sortMapKeys(seen, keys)
+		keys = p.withoutOmitted(v, keys)
+		multiline := p.indent != "" && len(keys) != 0
+		p.openComposite(v.Type(), indent, multiline)
+		if multiline {
+			fmt.Fprintf(p.w, "\n")
+		}
+		if p.groupKeys != "" && t.Key().Kind() == reflect.String {
+			p.groupedEntries(seen, path, v, keys, 0, ni)
+		} else {
+			p.mapEntries(seen, path, v, keys, ni)
+		}
+		if len(keys) != 0 {
+			p.markLine(path)
+			p.closeComposite(in, multiline)
+		} else {
+			fmt.Fprint(p.w, "}")
+		}
+
+	case reflect.Struct:
+		multiline := p.indent != "" && v.NumField() != 0
+		if showStructType {
+			p.openComposite(v.Type(), indent, multiline)
+		} else {
+			p.openComposite(nil, indent, multiline)
+		}
+		if multiline {
+			fmt.Fprintf(p.w, "\n")
+		}
+		previous := false
+		plan := planOf(v.Type())
+		order := p.fieldOrder(plan)
+		for oi, i := range order {
+			t := &plan.fields[i]
+			f := v.Field(i)
+			if p.isHeldLock(v, i) {
+				continue
+			}
+			hidden := false
+			if p.hideField(t, f) {
+				if p.markers.Hidden == "" || p.strictGo || !p.explicitlyHidden(t) {
+					continue
+				}
+				hidden = true
+			}
+			if p.omitNil && isNil(f) {
+				continue
+			}
+			if p.omitEmpty && p.isEmpty(f) {
+				continue
+			}
+			if p.strictGo && t.Type.Name() == "" && (f.Kind() == reflect.Struct || f.Kind() == reflect.Array) && p.unexportedIn(t.Type) != nil {
+				// A literal of the field's type can't be written, so leave it zero.
+				p.degrade(path+"."+t.Name, "unexported type "+p.unexportedIn(t.Type).String()+" can not be represented")
+				continue
+			}
+			if previous && p.indent == "" {
+				fmt.Fprintf(p.w, ", ")
+			}
+			previous = true
+			fp := ""
+			if p.needsPath(f) {
+				fp = path + "." + t.Name
+			}
+			p.markLine(fp)
+			fmt.Fprint(p.w, ni)
+			p.writeToken(fieldToken, p.fieldName(t))
+			fmt.Fprint(p.w, ": ")
+			isAnyValue := t.Type.Kind() == reflect.Interface
+			note := ""
+			if hidden {
+				p.writeComment(p.markers.Hidden)
+			} else if decoded, encodings, ok := p.decodeField(t, f); ok {
+				f, isAnyValue, note = decoded, true, "decoded from "+encodings
+			} else if budget, ok := p.fieldBudget(t); ok {
+				if f, note = truncate(f, budget, p.markers.More); note != "" {
+					fp = path + "." + t.Name
+					if p.strictGo {
+						p.degrade(fp, "truncated")
+					} else {
+						p.warn(fp, "truncated")
+					}
+				}
+			}
+			if !hidden {
+				p.reprValue(seen, fp, f, ni, true, isAnyValue)
+			}
+			if note != "" {
+				fmt.Fprint(p.w, " ")
+				p.writeComment(note)
+			}
+			if p.showLayout {
+				fmt.Fprint(p.w, " ")
+				p.writeComment(fieldLayout(v.Type(), i))
+			}
+
+			// if private fields should be ignored, look up if a public
+			// field need to be displayed and breaks at the first public
+			// field found preventing from looping over all remaining
+			// fields.
+			//
+			// If no other field need to be displayed, continue and do
+			// not print a comma.
+			//
+			// This prevents from having a trailing comma if a private
+			// field ends a structure.
+			if p.ignorePrivate && !p.diffFriendly && p.layoutVersion < 2 {
+				nc := false
+				for _, j := range order[oi+1:] {
+					if v.Field(j).CanInterface() {
+						nc = true
+						// exit for j loop
+						break
+					}
+				}
+				// Skip comma display if no remaining public field found.
+				if !nc {
+					continue
+				}
+			}
+			if p.indent != "" {
+				fmt.Fprintf(p.w, ",\n")
+			}
+		}
+		p.markLine(path)
+		p.closeComposite(indent, multiline)
+	case reflect.Ptr:
+		if v.IsNil() {
+			fmt.Fprintf(p.w, "nil")
+			return
+		}
+		elem := v.Elem()
+		if p.lockStructs && !seen[elem] {
+			var release func()
+			var snapshot bool
+			var lockField int
+			elem, lockField, snapshot, release = p.lockStruct(v)
+			defer release()
+			if lockField >= 0 {
+				// The lock is held by the printer, so its state says nothing about the struct.
+				if p.heldLocks == nil {
+					p.heldLocks = map[cloneKey]int{}
+				}
+				key := cloneKey{ptr: elem.UnsafeAddr(), typ: elem.Type()}
+				p.heldLocks[key] = lockField
+				defer delete(p.heldLocks, key)
+			}
+			if snapshot {
+				// Detect cycles back to the original struct while printing a snapshot of it.
+				seen[v.Elem()] = true
+				p.ancestors = append(p.ancestors, ancestor{v.Elem(), path})
+				defer func() {
+					delete(seen, v.Elem())
+					p.ancestors = p.ancestors[:len(p.ancestors)-1]
+				}()
+			}
+		}
+		if p.isCycle(seen, elem) && (p.strictGo || p.cycleMarkers()) {
+			// Print the cycle marker in place of the pointer, rather than after "&".
+			p.reprValue(seen, path, elem, indent, showStructType, false)
+			return
+		}
+		if p.showAddresses {
+			p.writeComment(p.pointerAddress(v))
+			fmt.Fprint(p.w, " ")
+		}
+		if p.strictGo {
+			// Only composite literals can have their address taken directly, so construct pointers to
+			// anything else, including other pointers, with new() or a function literal.
+			if e := elem; !p.isCompositeLiteral(e) {
+				if e.IsZero() {
+					fmt.Fprint(p.w, "new(")
+					p.writeTypeName(e.Type(), indent)
+					fmt.Fprint(p.w, ")")
+					return
+				}
+				fmt.Fprint(p.w, "func() ")
+				p.writeTypeName(t, indent)
+				fmt.Fprint(p.w, " { var v ")
+				p.writeTypeName(e.Type(), indent)
+				fmt.Fprint(p.w, " = ")
+				p.reprValue(seen, path, e, indent, true, false)
+				fmt.Fprint(p.w, "; return &v }()")
+				return
+			}
+		}
+		if showStructType {
+			fmt.Fprintf(p.w, "&")
+		}
+		// Pointers stored in interfaces keep the type of their element.
+		p.reprValue(seen, path, elem, indent, showStructType, isAnyValue)
+
+	case reflect.String:
+		value := strconv.Quote(v.String())
+		if p.hoist != nil {
+			value = p.hoist.internString(value)
+		}
+		if t.Name() != "string" || p.alwaysIncludeType {
+			p.writeToken(typeToken, formatTypeIn(t, "", "", p.imports))
+			fmt.Fprint(p.w, "(")
+			p.writeToken(stringToken, value)
+			fmt.Fprint(p.w, ")")
+		} else {
+			p.writeToken(stringToken, value)
+		}
+
+	case reflect.Interface:
+		if v.IsNil() {
+			p.writeTypeName(v.Type(), indent)
+			fmt.Fprint(p.w, "(nil)")
+		} else if e := v.Elem(); p.strictGo && isUnexported(e.Type()) && !p.isLocal(e.Type()) && constructor(accessible(e)) == nil && namedRenderer(e.Type()) == nil {
+			// The dynamic type can't be named outside its package, so describe it instead.
+			p.degrade(path, "unexported type "+e.Type().String()+" can not be represented")
+			fmt.Fprint(p.w, "nil ")
+			p.writeComment(p.markers.Unexported + " type " + e.Type().String())
+		} else {
+			p.reprValue(seen, path, e, indent, true, true)
+		}
+
+	case reflect.Func:
+		switch {
+		case p.hideFuncs:
+			fmt.Fprint(p.w, "nil")
+		case p.strictGo:
+			p.degrade(path, "func elided")
+			fmt.Fprint(p.w, "nil ")
+			p.writeComment(p.markers.Func)
+		case p.maxIterations > 0 && isIterator(t) && v.CanInterface():
+			if !p.printIterator(seen, path, v, indent) {
+				p.writeTypeName(v.Type(), indent)
+			}
+		default:
+			p.warn(path, "func rendered as its type")
+			p.writeTypeName(v.Type(), indent)
+		}
+
+	default:
+		value := fmt.Sprintf("%v", v)
+		if p.useLiterals || p.strictGo {
+			value = fmt.Sprintf("%#v", v)
+		}
+		// fmt recovers from panics in String() and GoString() methods, so detect that and fall back to a literal.
+		if strings.HasPrefix(value, "%!v(PANIC=") {
+			p.degrade(path, strings.TrimSuffix(strings.TrimPrefix(value, "%!v(PANIC="), ")"))
+			value = scalarLiteral(v)
+		}
+		special := false
+		switch t.Kind() {
+		case reflect.Uintptr, reflect.UnsafePointer:
+			value = p.address(v)
+		}
+		if p.strictGo && (t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64) {
+			value, special = floatToGo(v.Float(), value)
+		}
+		if t.Name() != realKindName[t.Kind()] || p.alwaysIncludeType || isAnyValue || special {
+			p.writeToken(typeToken, formatTypeIn(t, "", "", p.imports))
+			fmt.Fprint(p.w, "(")
+			p.writeToken(numberToken, value)
+			fmt.Fprint(p.w, ")")
+		} else if p.parenNegative && strings.HasPrefix(value, "-") {
+			fmt.Fprint(p.w, "(")
+			p.writeToken(numberToken, value)
+			fmt.Fprint(p.w, ")")
+		} else {
+			p.writeToken(numberToken, value)
+		}
+	}
+}
+
+// Returns the address shown for non-nil pointer v by ShowAddresses.
+func (p *Printer) pointerAddress(v reflect.Value) string {
+	if p.pointerIDs == nil {
+		return fmt.Sprintf("%#x", v.Pointer())
+	}
+	key := cloneKey{v.Pointer(), v.Type(), 0}
+	id, ok := p.pointerIDs[key]
+	if !ok {
+		id = len(p.pointerIDs) + 1
+		p.pointerIDs[key] = id
+	}
+	return "p" + strconv.Itoa(id)
+}
+
+// Formats a uintptr or unsafe.Pointer as fixed width hex.
+func (p *Printer) address(v reflect.Value) string {
+	var addr uintptr
+	if !p.zeroUintptrs {
+		if v.Kind() == reflect.UnsafePointer {
+			addr = v.Pointer()
+		} else {
+			addr = uintptr(v.Uint())
+		}
+	}
+	return fmt.Sprintf("0x%0*x", unsafe.Sizeof(addr)*2, addr)
+}
+
+// Reports whether a struct field should be excluded from output.
+func (p *Printer) hideField(field *fieldPlan, v reflect.Value) bool {
+	if p.explicitlyHidden(field) {
+		return true
+	}
+	if !field.inJSON && p.useJSONNames {
+		return true
+	}
+	// skip private fields
+	if p.ignorePrivate && !v.CanInterface() {
+		return true
+	}
+	return p.omitValue(v)
+}
+
+// Reports whether field is hidden by Hide, HideField, HideImplementing or HideGeneric.
+func (p *Printer) explicitlyHidden(field *fieldPlan) bool {
+	if p.exclude[field.Type] || p.hiddenGeneric(field.Type) {
+		return true
+	}
+	for _, iface := range p.hiddenInterfaces {
+		if field.Type.Implements(iface) {
+			return true
+		}
+	}
+	return p.hiddenFields[field.Name] || (field.inJSON && p.hiddenFields[field.jsonName])
+}
+
+// Prints b in the format chosen by Bytes.
+func (p *Printer) printBytes(b []byte) {
+	if p.bytesFormat == BytesString || p.bytesFormat == BytesAuto && (p.layoutVersion < 4 || isText(b)) {
+		fmt.Fprintf(p.w, "[]byte(%q)", b)
+		return
+	}
+	fmt.Fprint(p.w, "[]byte{")
+	for i, c := range b {
+		if i > 0 {
+			fmt.Fprint(p.w, ", ")
+		}
+		fmt.Fprintf(p.w, "0x%02x", c)
+	}
+	fmt.Fprint(p.w, "}")
+}
+
+// Reports whether b is UTF-8 text containing only printable characters and whitespace.
+func isText(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && r != '\n' && r != '\r' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the FieldBudget for a struct field, if any.
+func (p *Printer) fieldBudget(field *fieldPlan) (int, bool) {
+	if budget, ok := p.fieldBudgets[field.Name]; ok {
+		return budget, true
+	}
+	if field.inJSON {
+		budget, ok := p.fieldBudgets[field.jsonName]
+		return budget, ok
+	}
+	return 0, false
+}
+
+// Truncates a string, []byte or slice to at most n bytes or elements, returning the truncated value
+// and a description of what was removed using the More marker, or v and "" if it is within budget.
+func truncate(v reflect.Value, n int, more string) (reflect.Value, string) {
+	switch v.Kind() {
+	case reflect.String:
+		s := v.String()
+		if len(s) <= n {
+			return v, ""
+		}
+		cut := n
+		// Don't split a multi-byte character.
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		unit := "bytes"
+		if len(s)-cut == 1 {
+			unit = "byte"
+		}
+		return reflect.ValueOf(s[:cut]).Convert(v.Type()), fmt.Sprintf("%d %s %s", len(s)-cut, more, unit)
+	case reflect.Slice:
+		if v.Len() <= n {
+			return v, ""
+		}
+		unit := "element"
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			unit = "byte"
+		}
+		if v.Len()-n != 1 {
+			unit += "s"
+		}
+		return v.Slice(0, n), fmt.Sprintf("%d %s %s", v.Len()-n, more, unit)
+	}
+	return v, ""
+}
+
+// Reports whether t is an instantiation of a generic type hidden by HideGeneric.
+func (p *Printer) hiddenGeneric(t reflect.Type) bool {
+	if len(p.hiddenGenerics) == 0 || !strings.Contains(t.Name(), "[") {
+		return false
+	}
+	name := strings.SplitN(t.Name(), "[", 2)[0]
+	pkg := strings.SplitN(t.String(), ".", 2)[0]
+	return p.hiddenGenerics[pkg+"."+name] || p.hiddenGenerics[t.PkgPath()+"."+name]
+}
+
+// Reports whether field value v is empty, and so omitted by OmitEmpty.
+func (p *Printer) isEmpty(v reflect.Value) bool {
+	t := v.Type()
+	return v.IsZero() ||
+		t.Kind() == reflect.Slice && v.Len() == 0 ||
+		t.Kind() == reflect.Map && v.Len() == 0
+}
+
+// Reports whether v is a nil pointer, interface, map, slice, channel or func.
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Chan, reflect.Slice, reflect.Func, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+// Wraps a type in parentheses if required for it to be used in a conversion, eg. `(*int)(nil)`.
+func conversionType(name string) string {
+	if strings.HasPrefix(name, "*") || strings.HasPrefix(name, "func") || strings.HasPrefix(name, "<-") {
+		return "(" + name + ")"
+	}
+	return name
+}
+
+// Returns the name to display for a struct field.
+func (p *Printer) fieldName(field *fieldPlan) string {
+	if p.useJSONNames && field.inJSON {
+		return field.jsonName
+	}
+	return field.Name
+}
+
+// Returns the json name of a struct field, or false if the field is excluded from json with "-".
+func jsonName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name, true
+	}
+	return field.Name, true
+}
+
+// Reports whether v should be omitted from structs and maps, such as when hiding funcs.
+func (p *Printer) omitValue(v reflect.Value) bool {
+	if v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	return (p.hideFuncs && v.Kind() == reflect.Func) || (p.chanPolicy == ChanOmit && v.Kind() == reflect.Chan)
+}
+
+// Returns the keys of map m whose values shouldn't be omitted.
+func (p *Printer) withoutOmitted(m reflect.Value, keys []reflect.Value) []reflect.Value {
+	out := keys[:0]
+	for _, k := range keys {
+		if !p.omitValue(m.MapIndex(k)) {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// Reports whether t, or the type it points to, is an unexported named type.
+func isUnexported(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr && t.Name() == "" {
+		t = t.Elem()
+	}
+	return t.PkgPath() != "" && t.Name() != "" && !ast.IsExported(t.Name())
+}
+
+// Reports whether named type t, or the type it points to, is in the package GoVars generates code in.
+func (p *Printer) isLocal(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr && t.Name() == "" {
+		t = t.Elem()
+	}
+	return p.localPkg != "" && t.PkgPath() != "" && strings.SplitN(t.String(), ".", 2)[0] == p.localPkg
+}
+
+// Returns the first named type referenced by t that isn't exported from its package, other than the
+// package GoVars generates code in, or nil.
+func (p *Printer) unexportedIn(t reflect.Type) reflect.Type {
+	if t.Name() != "" {
+		if t.PkgPath() != "" && !ast.IsExported(t.Name()) && !p.isLocal(t) {
+			return t
+		}
+		return nil
+	}
+	var refs []reflect.Type
+	switch t.Kind() {
+	case reflect.Array, reflect.Slice, reflect.Ptr, reflect.Chan:
+		refs = append(refs, t.Elem())
+	case reflect.Map:
+		refs = append(refs, t.Key(), t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			refs = append(refs, t.Field(i).Type)
+		}
+	case reflect.Func:
+		for i := 0; i < t.NumIn(); i++ {
+			refs = append(refs, t.In(i))
+		}
+		for i := 0; i < t.NumOut(); i++ {
+			refs = append(refs, t.Out(i))
+		}
+	}
+	for _, ref := range refs {
+		if u := p.unexportedIn(ref); u != nil {
+			return u
+		}
+	}
+	return nil
+}
+
+// Returns the order in which to print the elements of a slice or array.
+func (p *Printer) sliceOrder(seen map[reflect.Value]bool, v reflect.Value) []int {
+	order := make([]int, v.Len())
+	for i := range order {
+		order[i] = i
+	}
+	switch {
+	case p.sortSlices != nil:
+		sort.SliceStable(order, func(i, j int) bool { return p.sortSlices(v.Index(order[i]), v.Index(order[j])) })
+	case p.canonical:
+		reprs := make([]string, len(order))
+		for i := range reprs {
+			reprs[i] = p.flatString(seen, v.Index(i))
+		}
+		sort.SliceStable(order, func(i, j int) bool { return reprs[order[i]] < reprs[order[j]] })
+	}
+	return order
+}
+
+// Returns the element of struct pointer v, either by calling its Snapshot() method or by holding the
+// embedded sync.Mutex or sync.RWMutex of the struct until release is called. lockField is the index of
+// the embedded lock, or -1 if there is none.
+func (p *Printer) lockStruct(v reflect.Value) (elem reflect.Value, lockField int, snapshot bool, release func()) {
+	t := v.Type()
+	if !v.CanInterface() || t.Elem().Kind() != reflect.Struct {
+		return v.Elem(), -1, false, func() {}
+	}
+	lockField = -1
+	for i := 0; i < t.Elem().NumField(); i++ {
+		if f := t.Elem().Field(i); f.Anonymous && (f.Type == mutexType || f.Type == rwMutexType) {
+			lockField = i
+			break
+		}
+	}
+	if m := v.MethodByName("Snapshot"); m.IsValid() && m.Type().NumIn() == 0 && m.Type().NumOut() == 1 && m.Type().Out(0) == t.Elem() {
+		// Copy the snapshot so that it is addressable, like the element of a pointer.
+		elem = reflect.New(t.Elem()).Elem()
+		elem.Set(m.Call(nil)[0])
+		return elem, lockField, true, func() {}
+	}
+	if lockField < 0 {
+		return v.Elem(), -1, false, func() {}
+	}
+	// Only the embedded lock is used, as other Lock() methods may do anything, such as locking files.
+	lock := v.Elem().Field(lockField).Addr().Interface()
+	if l, ok := lock.(*sync.RWMutex); ok {
+		l.RLock()
+		return v.Elem(), lockField, false, l.RUnlock
+	}
+	l := lock.(*sync.Mutex)
+	l.Lock()
+	return v.Elem(), lockField, false, l.Unlock
+}
+
+// Reports whether field i of struct v is a lock that is held while v is printed.
+func (p *Printer) isHeldLock(v reflect.Value, i int) bool {
+	if len(p.heldLocks) == 0 || !v.CanAddr() {
+		return false
+	}
+	field, ok := p.heldLocks[cloneKey{ptr: v.UnsafeAddr(), typ: v.Type()}]
+	return ok && field == i
+}
+
+// Returns the result of the resolve hook for v, if it applies.
+func (p *Printer) resolved(v reflect.Value) (reflect.Value, bool) {
+	if !hasResolver(v.Type()) && v.CanAddr() && hasResolver(reflect.PtrTo(v.Type())) {
+		v = v.Addr()
+	}
+	if !hasResolver(v.Type()) || !v.CanInterface() {
+		return reflect.Value{}, false
+	}
+	r, ok := p.resolve(v.Interface())
+	if !ok {
+		return reflect.Value{}, false
+	}
+	rv := reflect.ValueOf(r)
+	if rv.IsValid() && (rv.Type() == v.Type() || v.Kind() == reflect.Ptr && rv.Type() == v.Type().Elem()) {
+		// Don't resolve the same type forever.
+		return reflect.Value{}, false
+	}
+	return rv, true
+}
+
+func hasResolver(t reflect.Type) bool {
+	_, load := t.MethodByName("Load")
+	_, get := t.MethodByName("Get")
+	return load || get
+}
+
+// LazyValue resolves v by calling a "Load() T" or "Get() (T, error)" method. If Get returns an error,
+// the error is the resolved value.
+//
+// It is intended for use with Resolve.
+func LazyValue(v any) (any, bool) {
+	rv := reflect.ValueOf(v)
+	if m := rv.MethodByName("Load"); m.IsValid() && m.Type().NumIn() == 0 && m.Type().NumOut() == 1 {
+		return m.Call(nil)[0].Interface(), true
+	}
+	if m := rv.MethodByName("Get"); m.IsValid() && m.Type().NumIn() == 0 && m.Type().NumOut() == 2 && m.Type().Out(1) == errorType {
+		out := m.Call(nil)
+		if !out[1].IsNil() {
+			return out[1].Interface(), true
 		}
-		fmt.Fprintf(p.w, "%s}", in)
+		return out[0].Interface(), true
+	}
+	return nil, false
+}
+
+// Writes a summary of a value of type t.
+func (p *Printer) summary(path string, t reflect.Type, indent string, s string) {
+	s = strings.ReplaceAll(s, "*/", "* /")
+	if !p.strictGo {
+		p.writeTypeName(t, indent)
+		fmt.Fprint(p.w, " ")
+		p.writeComment(s)
+		return
+	}
+	p.degrade(path, "summarized "+t.String())
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func, reflect.Interface:
+		fmt.Fprint(p.w, "nil ")
+		p.writeComment(s)
+	default:
+		zero := *p
+		zero.summaries = nil
+		fmt.Fprintf(p.w, "%s ", zero.flatString(map[reflect.Value]bool{}, reflect.Zero(t)))
+		p.writeComment(s)
+	}
+}
+
+// Writes a placeholder for v, whose unnamed type refers to an unexported type, which can't be named in
+// StrictGo mode. Slices and maps are nil, and arrays and structs are literals with their type elided.
+func (p *Printer) unexportedValue(path string, v reflect.Value) {
+	u := p.unexportedIn(v.Type())
+	note := "type " + u.String() + " " + p.markers.Unexported
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		unit := "elements"
+		switch {
+		case v.Kind() == reflect.Map && v.Len() == 1:
+			unit = "entry"
+		case v.Kind() == reflect.Map:
+			unit = "entries"
+		case v.Len() == 1:
+			unit = "element"
+		}
+		note = fmt.Sprintf("%d %s, %s", v.Len(), unit, note)
+	}
+	p.degrade(path, "unexported type "+u.String()+" can not be represented")
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		fmt.Fprint(p.w, "nil ")
+		p.writeComment(note)
+	default:
+		fmt.Fprint(p.w, "{")
+		p.writeComment(note)
+		fmt.Fprint(p.w, "}")
+	}
+}
+
+// Returns the memory layout of field i of struct type t.
+func fieldLayout(t reflect.Type, i int) string {
+	f := t.Field(i)
+	end := t.Size()
+	if i+1 < t.NumField() {
+		end = t.Field(i + 1).Offset
+	}
+	layout := fmt.Sprintf("off=%d size=%d align=%d", f.Offset, f.Type.Size(), f.Type.Align())
+	if pad := end - f.Offset - f.Type.Size(); pad > 0 {
+		layout += fmt.Sprintf(" pad=%d", pad)
+	}
+	return layout
+}
+
+// Returns the approximate memory referenced by v but not stored inline in it.
+func indirectSize(v reflect.Value) uint64 {
+	switch v.Kind() {
+	case reflect.String:
+		return uint64(v.Len())
+	case reflect.Slice:
+		return uint64(v.Cap()) * uint64(v.Type().Elem().Size())
+	case reflect.Map:
+		// Ignores the overhead of buckets, which depends on the runtime.
+		return uint64(v.Len()) * uint64(v.Type().Key().Size()+v.Type().Elem().Size())
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return uint64(v.Type().Elem().Size())
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			return uint64(v.Elem().Type().Size())
+		}
+	}
+	return 0
+}
 
-	case reflect.Struct:
-		if td, ok := asTime(v); ok {
-			timeToGo(p.w, td)
+// Describes channel type t for ChanInfo.
+func chanInfo(t reflect.Type) string {
+	dir := "both"
+	switch t.ChanDir() {
+	case reflect.RecvDir:
+		dir = "recv"
+	case reflect.SendDir:
+		dir = "send"
+	}
+	return fmt.Sprintf("elem size=%s, dir=%s", formatSize(uint64(t.Elem().Size())), dir)
+}
+
+// Returns n bytes in human readable form, eg. "48KB".
+func formatSize(n uint64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	unit := 0
+	for n >= 1024*10 && unit < len(units)-1 {
+		n /= 1024
+		unit++
+	}
+	return strconv.FormatUint(n, 10) + units[unit]
+}
+
+// Prints a placeholder for a value that no longer exists, such as the value of a map entry that
+// was deleted while the map was being printed.
+func (p *Printer) printInvalid(path string) {
+	if p.strictGo {
+		p.degrade(path, "invalid value")
+		fmt.Fprint(p.w, "nil ")
+		p.writeComment(p.markers.Invalid)
+		return
+	}
+	p.warn(path, "invalid value")
+	p.writeComment(p.markers.Invalid)
+}
+
+// Prints the entries of map v with the given keys.
+func (p *Printer) mapEntries(seen map[reflect.Value]bool, path string, v reflect.Value, keys []reflect.Value, ni string) {
+	for i, k := range keys {
+		kv := v.MapIndex(k)
+		kp := ""
+		if p.needsPath(kv) || !kv.IsValid() {
+			kp = path + "[" + p.flatKey(seen, k) + "]"
+		}
+		p.markLine(kp)
+		fmt.Fprintf(p.w, "%s", ni)
+		p.reprValue(seen, kp, k, ni, p.alwaysIncludeType || p.explicitTypes, v.Type().Key().Kind() == reflect.Interface)
+		fmt.Fprintf(p.w, ": ")
+		if kv.IsValid() {
+			p.reprValue(seen, kp, kv, ni, true, v.Type().Elem().Kind() == reflect.Interface)
 		} else {
-			if showStructType {
-				fmt.Fprintf(p.w, "%s{", substAny(v.Type()))
+			p.printInvalid(kp)
+		}
+		p.entrySeparator(i == len(keys)-1)
+	}
+}
+
+// Prints the entries of map v with string keys, nesting entries whose keys share a prefix ending in
+// the GroupKeys separator. trim is the length of the prefix already printed.
+func (p *Printer) groupedEntries(seen map[reflect.Value]bool, path string, v reflect.Value, keys []reflect.Value, trim int, ni string) {
+	type group struct {
+		prefix string
+		keys   []reflect.Value
+	}
+	var groups []*group
+	byPrefix := map[string]*group{}
+	for _, k := range keys {
+		rest := k.String()[trim:]
+		prefix := ""
+		if i := strings.Index(rest, p.groupKeys); i >= 0 {
+			prefix = rest[:i+len(p.groupKeys)]
+		}
+		g := byPrefix[prefix]
+		if g == nil || prefix == "" {
+			g = &group{prefix: prefix}
+			byPrefix[prefix] = g
+			groups = append(groups, g)
+		}
+		g.keys = append(g.keys, k)
+	}
+	for i, g := range groups {
+		if len(g.keys) == 1 {
+			k := g.keys[0]
+			kp := path + "[" + p.flatKey(seen, k) + "]"
+			p.markLine(kp)
+			fmt.Fprintf(p.w, "%s%q: ", ni, k.String()[trim:])
+			if kv := v.MapIndex(k); kv.IsValid() {
+				p.reprValue(seen, kp, kv, ni, true, v.Type().Elem().Kind() == reflect.Interface)
 			} else {
-				fmt.Fprint(p.w, "{")
+				p.printInvalid(kp)
 			}
-			if p.indent != "" && v.NumField() != 0 {
-				fmt.Fprintf(p.w, "\n")
+		} else {
+			p.markLine(path)
+			fmt.Fprintf(p.w, "%s%q: {", ni, g.prefix)
+			if p.indent != "" {
+				fmt.Fprintln(p.w)
 			}
-			previous := false
-			for i := 0; i < v.NumField(); i++ {
-				t := v.Type().Field(i)
-				if p.exclude[t.Type] {
-					continue
-				}
-				f := v.Field(i)
-				ft := f.Type()
-				// skip private fields
-				if p.ignorePrivate && !f.CanInterface() {
-					continue
-				}
-				if p.omitEmpty && (f.IsZero() ||
-					ft.Kind() == reflect.Slice && f.Len() == 0 ||
-					ft.Kind() == reflect.Map && f.Len() == 0) {
-					continue
-				}
-				if previous && p.indent == "" {
-					fmt.Fprintf(p.w, ", ")
-				}
-				previous = true
-				fmt.Fprintf(p.w, "%s%s: ", ni, t.Name)
-				p.reprValue(seen, f, ni, true, t.Type == anyType)
-
-				// if private fields should be ignored, look up if a public
-				// field need to be displayed and breaks at the first public
-				// field found preventing from looping over all remaining
-				// fields.
-				//
-				// If no other field need to be displayed, continue and do
-				// not print a comma.
-				//
-				// This prevents from having a trailing comma if a private
-				// field ends a structure.
-				if p.ignorePrivate {
-					nc := false
-					for j := i + 1; j < v.NumField(); j++ {
-						if v.Field(j).CanInterface() {
-							nc = true
-							// exit for j loop
-							break
-						}
-					}
-					// Skip comma display if no remaining public field found.
-					if !nc {
-						continue
-					}
-				}
-				if p.indent != "" {
-					fmt.Fprintf(p.w, ",\n")
-				}
+			p.depth++
+			nested := p.nextIndent(ni)
+			p.groupedEntries(seen, path, v, g.keys, trim+len(g.prefix), nested)
+			p.depth--
+			p.markLine(path)
+			fmt.Fprintf(p.w, "%s}", ni)
+		}
+		p.entrySeparator(i == len(groups)-1)
+	}
+}
+
+// Writes the separator following an element of a composite value.
+func (p *Printer) entrySeparator(last bool) {
+	if p.indent != "" {
+		fmt.Fprintf(p.w, ",\n")
+	} else if !last {
+		fmt.Fprintf(p.w, ", ")
+	}
+}
+
+// Returns the order in which to print the fields of a struct. The result must not be modified.
+func (p *Printer) fieldOrder(plan *structPlan) []int {
+	if p.sortFields {
+		return plan.sorted
+	}
+	return plan.declared
+}
+
+// Information about a struct type that doesn't depend on options, computed once per type so that
+// printing many values of the same type doesn't repeat it.
+type structPlan struct {
+	fields   []fieldPlan
+	declared []int // Field indexes in declaration order.
+	sorted   []int // Field indexes sorted by name.
+}
+
+type fieldPlan struct {
+	reflect.StructField
+	jsonName string
+	inJSON   bool // False if the field is tagged `json:"-"`.
+}
+
+var structPlans sync.Map // map[reflect.Type]*structPlan
+
+// Returns the plan for struct type t.
+func planOf(t reflect.Type) *structPlan {
+	if plan, ok := structPlans.Load(t); ok {
+		return plan.(*structPlan)
+	}
+	plan := &structPlan{
+		fields:   make([]fieldPlan, t.NumField()),
+		declared: make([]int, t.NumField()),
+		sorted:   make([]int, t.NumField()),
+	}
+	for i := range plan.fields {
+		field := t.Field(i)
+		name, ok := jsonName(field)
+		plan.fields[i] = fieldPlan{StructField: field, jsonName: name, inJSON: ok}
+		plan.declared[i] = i
+		plan.sorted[i] = i
+	}
+	sort.SliceStable(plan.sorted, func(i, j int) bool {
+		return plan.fields[plan.sorted[i]].Name < plan.fields[plan.sorted[j]].Name
+	})
+	actual, _ := structPlans.LoadOrStore(t, plan)
+	return actual.(*structPlan)
+}
+
+// Reports whether v, which is being printed, fits within MaxWidth when printed on one line.
+func (p *Printer) fitsOnLine(seen map[reflect.Value]bool, v reflect.Value, showStructType, isAnyValue bool) bool {
+	out := p.w
+	if hw, ok := out.(*htmlWriter); ok {
+		out = hw.w
+	}
+	cw, ok := out.(*columnWriter)
+	if p.maxWidth <= 0 || p.indent == "" || !ok {
+		return false
+	}
+	// Allow for the prefix, and a trailing comma.
+	limit := p.maxWidth - len(p.prefix) - cw.column - 1
+	if limit < 0 {
+		return false
+	}
+	delete(seen, v)
+	defer func() { seen[v] = true }()
+	w := &limitWriter{limit: limit}
+	if !p.printsWithin(w, seen, v, showStructType, isAnyValue) {
+		return false
+	}
+	return !strings.Contains(w.String(), "\n")
+}
+
+// Panicked with by limitWriter to stop printing once output is known not to fit.
+var errTooLong = errors.New("too long")
+
+// Collects output, panicking with errTooLong once more than limit bytes are written.
+type limitWriter struct {
+	strings.Builder
+	limit int
+}
+
+func (l *limitWriter) Write(b []byte) (int, error) {
+	if l.Len()+len(b) > l.limit {
+		panic(errTooLong)
+	}
+	return l.Builder.Write(b)
+}
+
+// Prints v on one line to w, returning false if printing was stopped because it was too long. This
+// bounds the cost of checking whether a large value fits by the width, not the size of the value.
+func (p *Printer) printsWithin(w *limitWriter, seen map[reflect.Value]bool, v reflect.Value, showStructType, isAnyValue bool) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if r != errTooLong {
+				panic(r)
 			}
-			fmt.Fprintf(p.w, "%s}", indent)
+			ok = false
 		}
-	case reflect.Ptr:
-		if v.IsNil() {
-			fmt.Fprintf(p.w, "nil")
-			return
+	}()
+	p.flatReprTo(w, seen, v, showStructType, isAnyValue)
+	return true
+}
+
+// Returns v represented on a single line.
+func (p *Printer) flatString(seen map[reflect.Value]bool, v reflect.Value) string {
+	return p.flatRepr(seen, v, true, false)
+}
+
+// Returns v represented on a single line, as it would be printed in the given context.
+func (p *Printer) flatRepr(seen map[reflect.Value]bool, v reflect.Value, showStructType, isAnyValue bool) string {
+	w := &strings.Builder{}
+	p.flatReprTo(w, seen, v, showStructType, isAnyValue)
+	return w.String()
+}
+
+// Prints v on a single line to w, as it would be printed in the given context.
+func (p *Printer) flatReprTo(w io.Writer, seen map[reflect.Value]bool, v reflect.Value, showStructType, isAnyValue bool) {
+	flat := *p
+	flat.w = w
+	flat.indent = ""
+	flat.degraded = nil
+	flat.onWarning = nil
+	flat.sizeComments = false
+	flat.hoist = nil
+	flat.colored = false
+	flat.reprValue(seen, "", v, "", showStructType, isAnyValue)
+}
+
+func (p *Printer) sortMapKeys(seen map[reflect.Value]bool, keys []reflect.Value) {
+	if len(keys) < 2 {
+		return
+	}
+	sortKeys := make([]string, len(keys))
+	for i, k := range keys {
+		if p.deterministic {
+			// Sort by representation, as fmt includes addresses for pointer keys.
+			sortKeys[i] = p.flatString(seen, k)
+		} else {
+			sortKeys[i] = fmt.Sprint(k)
 		}
-		if showStructType {
-			fmt.Fprintf(p.w, "&")
+		// Keys of different types can have the same representation, eg. 1 and "1", so sort interface
+		// keys by type first, with nil first of all.
+		if k.Kind() == reflect.Interface && p.layoutVersion >= 5 {
+			typeName := ""
+			if !k.IsNil() {
+				typeName = k.Elem().Type().String()
+			}
+			sortKeys[i] = typeName + "\x00" + sortKeys[i]
 		}
-		p.reprValue(seen, v.Elem(), indent, showStructType, false)
+	}
+	sort.Sort(keysByString{keys, sortKeys, p.keyLess})
+}
 
-	case reflect.String:
-		if t.Name() != "string" || p.alwaysIncludeType {
-			fmt.Fprintf(p.w, "%s(%q)", t, v.String())
-		} else {
-			fmt.Fprintf(p.w, "%q", v.String())
+func (p *Printer) keyLess(a, b string) bool {
+	if p.keyCollation != nil {
+		if c := p.keyCollation(a, b); c != 0 {
+			return c < 0
 		}
+		return a < b
+	}
+	if p.naturalSort {
+		return naturalLess(a, b)
+	}
+	return a < b
+}
 
-	case reflect.Interface:
-		if v.IsNil() {
-			fmt.Fprintf(p.w, "%s(nil)", substAny(v.Type()))
-		} else {
-			p.reprValue(seen, v.Elem(), indent, true, true)
+// Reports whether a sorts before b, comparing runs of decimal digits by their numeric value.
+func naturalLess(a, b string) bool {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			si, sj := i, j
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			x := strings.TrimLeft(a[si:i], "0")
+			y := strings.TrimLeft(b[sj:j], "0")
+			if len(x) != len(y) {
+				return len(x) < len(y)
+			}
+			if x != y {
+				return x < y
+			}
+			continue
+		}
+		if a[i] != b[j] {
+			return a[i] < b[j]
 		}
+		i++
+		j++
+	}
+	if len(a)-i != len(b)-j {
+		return len(a)-i < len(b)-j
+	}
+	// Equal apart from leading zeros.
+	return a < b
+}
 
-	case reflect.Func:
-		fmt.Fprint(p.w, substAny(v.Type()))
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
 
-	default:
-		value := fmt.Sprintf("%v", v)
-		if p.useLiterals {
-			value = fmt.Sprintf("%#v", v)
+type keysByString struct {
+	keys    []reflect.Value
+	strings []string
+	// Compares strings, if not bytewise.
+	less func(a, b string) bool
+}
+
+func (k keysByString) Len() int { return len(k.keys) }
+func (k keysByString) Less(i, j int) bool {
+	if k.less == nil {
+		return k.strings[i] < k.strings[j]
+	}
+	return k.less(k.strings[i], k.strings[j])
+}
+func (k keysByString) Swap(i, j int) {
+	k.keys[i], k.keys[j] = k.keys[j], k.keys[i]
+	k.strings[i], k.strings[j] = k.strings[j], k.strings[i]
+}
+
+// Calls fn, recovering from and reporting any panic.
+func (p *Printer) safely(path, what string, fn func() string) (s string, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.degrade(path, fmt.Sprintf("%s panicked: %v", what, r))
+			ok = false
 		}
-		if t.Name() != realKindName[t.Kind()] || p.alwaysIncludeType || isAnyValue {
-			fmt.Fprintf(p.w, "%s(%s)", t, value)
-		} else {
-			fmt.Fprintf(p.w, "%s", value)
+	}()
+	return fn(), true
+}
+
+// Reports that the value at path could not be represented faithfully.
+func (p *Printer) degrade(path, reason string) {
+	if p.degraded != nil {
+		p.degraded(path, reason)
+	}
+	p.warn(path, reason)
+}
+
+// Reports that the value at path was rendered lossily, or as something that is not valid Go.
+func (p *Printer) warn(path, reason string) {
+	if p.onWarning != nil {
+		p.onWarning(displayPath(path), reason)
+	}
+}
+
+// The values being printed by printTop, pooled to avoid reallocating them for every value printed.
+type visitState struct {
+	seen      map[reflect.Value]bool
+	ancestors []ancestor
+}
+
+var visitStates = sync.Pool{New: func() any {
+	return &visitState{seen: map[reflect.Value]bool{}, ancestors: make([]ancestor, 0, 16)}
+}}
+
+// A value currently being printed, and its path.
+type ancestor struct {
+	v    reflect.Value
+	path string
+}
+
+// Reports whether values of kind k can refer back to themselves.
+func canCycle(k reflect.Kind) bool {
+	switch k {
+	case reflect.Ptr, reflect.Interface, reflect.Struct, reflect.Array, reflect.Slice, reflect.Map:
+		return true
+	}
+	return false
+}
+
+// Reports whether the path to v is needed, either for reporting or to identify it as the target of
+// a cycle.
+func (p *Printer) needsPath(v reflect.Value) bool {
+	return p.degraded != nil || p.onWarning != nil || p.gutter == GutterPaths || canCycle(v.Kind())
+}
+
+// Reports whether printing v, which may already be being printed, would be a cycle that is not
+// unrolled.
+func (p *Printer) isCycle(seen map[reflect.Value]bool, v reflect.Value) bool {
+	if !seen[v] {
+		return false
+	}
+	if p.unrollCycles == 0 {
+		return true
+	}
+	visits := 0
+	for _, a := range p.ancestors {
+		if a.v == v {
+			visits++
 		}
 	}
+	return visits > p.unrollCycles
 }
 
-func asTime(v reflect.Value) (time.Time, bool) {
-	if !v.CanInterface() {
-		return time.Time{}, false
+// Reports whether cycles are marked with Markers.Cycle and the path they cycle back to.
+func (p *Printer) cycleMarkers() bool {
+	return p.layoutVersion >= 3 || p.explicitCycle
+}
+
+// Returns the text of the marker for a cycle back to v, identifying where v was printed.
+func (p *Printer) cycleTo(v reflect.Value) string {
+	if !p.cycleMarkers() {
+		return "cycle"
+	}
+	for i := len(p.ancestors) - 1; i >= 0; i-- {
+		if p.ancestors[i].v == v {
+			return p.markers.Cycle + " " + displayPath(p.ancestors[i].path)
+		}
+	}
+	return p.markers.Cycle
+}
+
+// Returns path as shown to users, without the leading "." and with the top-level value as "<root>".
+func displayPath(path string) string {
+	path = strings.TrimPrefix(path, ".")
+	if path == "" {
+		return "<root>"
+	}
+	return path
+}
+
+// Returns the literal representation of a scalar without calling any of its methods.
+func scalarLiteral(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	case reflect.Complex64, reflect.Complex128:
+		return strconv.FormatComplex(v.Complex(), 'g', -1, v.Type().Bits())
+	}
+	return "nil"
+}
+
+// If we can't access a private field directly with reflection, try and do so via unsafe.
+func accessible(v reflect.Value) reflect.Value {
+	if !v.CanInterface() && v.CanAddr() {
+		uv := reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem()
+		if uv.CanInterface() {
+			return uv
+		}
+	}
+	return v
+}
+
+// Reports whether v will be represented as a composite literal, and so can have its address taken.
+func (p *Printer) isCompositeLiteral(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Struct, reflect.Array:
+	case reflect.Slice, reflect.Map:
+		if v.IsNil() {
+			return false
+		}
+	default:
+		return false
+	}
+	v = accessible(v)
+	t := v.Type()
+	if t == byteSliceType || t == timeType || constructor(v) != nil || namedRenderer(t) != nil {
+		return false
+	}
+	return p.ignoreGoStringer || !t.Implements(goStringerType)
+}
+
+// Returns a Go expression for float values that have no literal representation.
+func floatToGo(f float64, value string) (string, bool) {
+	switch {
+	case math.IsNaN(f):
+		return "math.NaN()", true
+	case math.IsInf(f, 1):
+		return "math.Inf(1)", true
+	case math.IsInf(f, -1):
+		return "math.Inf(-1)", true
 	}
-	t, ok := v.Interface().(time.Time)
-	return t, ok
+	return value, false
 }
 
 // String returns a string representing v.
@@ -360,6 +2609,108 @@ func String(v any, options ...Option) string {
 	return w.String()
 }
 
+// Quote returns the representation of v as a double-quoted Go string literal, for pasting into tests
+// that compare against String.
+func Quote(v any, options ...Option) string {
+	return strconv.Quote(String(v, options...))
+}
+
+// Markdown returns the representation of v as a fenced Go code block, preceded by the Caption option
+// if given.
+func Markdown(v any, options ...Option) string {
+	w := &strings.Builder{}
+	p := New(w, options...)
+	p.Print(v)
+	code := w.String()
+	// The fence must be longer than any run of backticks in the code.
+	fence, run := 3, 0
+	for _, r := range code {
+		if r == '`' {
+			run++
+			if run >= fence {
+				fence = run + 1
+			}
+		} else {
+			run = 0
+		}
+	}
+	out := ""
+	if p.caption != "" {
+		out = p.caption + "\n\n"
+	}
+	return out + strings.Repeat("`", fence) + "go\n" + code + "\n" + strings.Repeat("`", fence) + "\n"
+}
+
+// IndentBy prefixes every line of s after the first with prefix.
+//
+// This is useful for embedding the output of String, which starts at the current position, within other
+// indented text.
+func IndentBy(s string, prefix string) string {
+	return strings.ReplaceAll(s, "\n", "\n"+prefix)
+}
+
+// Safe returns a string representing v, like String, but never panics.
+//
+// If any part of v could not be represented faithfully, such as when a GoString() method panics, a
+// best-effort representation is returned along with an error describing each degradation.
+func Safe(v any, options ...Option) (s string, err error) {
+	w := bytes.NewBuffer(nil)
+	options = append([]Option{NoIndent()}, options...)
+	p := New(w, options...)
+	var degradations []string
+	p.degraded = func(_, reason string) { degradations = append(degradations, reason) }
+	defer func() {
+		if r := recover(); r != nil {
+			degradations = append(degradations, fmt.Sprintf("panic: %v", r))
+		}
+		s = w.String()
+		if len(degradations) > 0 {
+			err = fmt.Errorf("repr: %s", strings.Join(degradations, "; "))
+		}
+	}()
+	p.Print(v)
+	return
+}
+
+// Unrepresentable describes a value that could not be represented as compilable Go.
+type Unrepresentable struct {
+	// Path to the value from the top-level value, eg. "Field[0]". The top-level value is "<root>".
+	Path   string
+	Reason string
+}
+
+// UnrepresentableError is returned by PrintStrict when part of a value can not be represented.
+type UnrepresentableError struct {
+	Values []Unrepresentable
+}
+
+func (u *UnrepresentableError) Error() string {
+	reasons := make([]string, len(u.Values))
+	for i, v := range u.Values {
+		reasons[i] = v.Path + ": " + v.Reason
+	}
+	return "repr: unrepresentable values: " + strings.Join(reasons, "; ")
+}
+
+// PrintStrict prints v in StrictGo mode, returning an *UnrepresentableError describing any part of
+// v that could not be represented.
+func (p *Printer) PrintStrict(v any) error {
+	strict := *p
+	strict.strictGo = true
+	err := &UnrepresentableError{}
+	strict.degraded = func(path, reason string) {
+		err.Values = append(err.Values, Unrepresentable{Path: displayPath(path), Reason: reason})
+	}
+	value := p.valueOf(v)
+	p.outLock.Lock()
+	strict.printTop(value)
+	p.outLock.Unlock()
+	if len(err.Values) > 0 {
+		return err
+	}
+	return nil
+}
+
 func extractOptions(vs ...any) (args []any, options []Option) {
 	for _, v := range vs {
 		if o, ok := v.(Option); ok {
@@ -383,10 +2734,91 @@ func Print(vs ...any) {
 	New(os.Stdout, options...).Print(args...)
 }
 
-func timeToGo(w io.Writer, t time.Time) {
+// Sprint returns the representation of vs, as written by Print.
+func Sprint(vs ...any) string {
+	args, options := extractOptions(vs...)
+	return New(nil, options...).Sprint(args...)
+}
+
+// Sprintln returns the representation of vs, as written by Println.
+func Sprintln(vs ...any) string {
+	args, options := extractOptions(vs...)
+	return New(nil, options...).Sprintln(args...)
+}
+
+// Sprintf formats according to a format specifier like fmt.Sprintf, with the additional verb %r
+// replaced by the representation of the corresponding argument on a single line.
+//
+// Options may be included among args.
+func Sprintf(format string, args ...any) string {
+	args, options := extractOptions(args...)
+	options = append([]Option{NoIndent()}, options...)
+	return New(nil, options...).Sprintf(format, args...)
+}
+
+// PrintSlice writes each element of slice to os.Stdout as a separate record.
+func PrintSlice(slice any, options ...Option) {
+	New(os.Stdout, options...).PrintSlice(slice)
+}
+
+// Tracks the column that output has reached.
+type columnWriter struct {
+	w      io.Writer
+	html   bool // Whether output is escaped HTML, with markup.
+	column int
+}
+
+func (c *columnWriter) Write(b []byte) (int, error) {
+	width := visibleWidth
+	if c.html {
+		width = htmlWidth
+	}
+	if i := bytes.LastIndexByte(b, '\n'); i >= 0 {
+		c.column = width(string(b[i+1:]))
+	} else {
+		c.column += width(string(b))
+	}
+	return c.w.Write(b)
+}
+
+// Writes prefix before every line after the first.
+type prefixWriter struct {
+	w       io.Writer
+	prefix  []byte
+	pending bool
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	n := 0
+	for len(b) > 0 {
+		if p.pending {
+			if _, err := p.w.Write(p.prefix); err != nil {
+				return n, err
+			}
+			p.pending = false
+		}
+		line := b
+		if i := bytes.IndexByte(b, '\n'); i >= 0 {
+			line = b[:i+1]
+			p.pending = true
+		}
+		written, err := p.w.Write(line)
+		n += written
+		if err != nil {
+			return n, err
+		}
+		b = b[len(line):]
+	}
+	return n, nil
+}
+
+func timeToGo(t time.Time) string { return formatTime(t, false) }
+
+// If loadLocation is true, locations that are IANA zones are loaded with time.LoadLocation rather
+// than being represented as a fixed zone.
+func formatTime(t time.Time, loadLocation bool) string {
 	if t.IsZero() {
-		fmt.Fprint(w, "time.Time{}")
-		return
+		return "time.Time{}"
 	}
 
 	var zone string
@@ -398,45 +2830,104 @@ func timeToGo(w io.Writer, t time.Time) {
 	case time.Local:
 		zone = "time.Local"
 	default:
+		if loadLocation {
+			if _, err := time.LoadLocation(loc.String()); err == nil {
+				zone = fmt.Sprintf("func() *time.Location { l, _ := time.LoadLocation(%q); return l }()", loc.String())
+				break
+			}
+		}
 		n, off := t.Zone()
 		zone = fmt.Sprintf("time.FixedZone(%q, %d)", n, off)
 	}
 	y, m, d := t.Date()
-	fmt.Fprintf(w, `time.Date(%d, %d, %d, %d, %d, %d, %d, %s)`, y, m, d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), zone)
+	return fmt.Sprintf(`time.Date(%d, %d, %d, %d, %d, %d, %d, %s)`, y, m, d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), zone)
+}
+
+// Writes the name of t, with anonymous struct types spread across lines if indenting.
+func (p *Printer) writeTypeName(t reflect.Type, indent string) {
+	p.writeToken(typeToken, formatTypeIn(t, p.thisIndent(indent), p.indent, p.imports))
 }
 
 // Replace "interface {}" with "any"
-func substAny(t reflect.Type) string {
+func substAny(t reflect.Type) string { return formatType(t, "", "") }
+
+// Formats t, replacing "interface {}" with "any". If step is not empty, the fields of anonymous
+// structs are placed on separate lines, indented by step relative to indent.
+func formatType(t reflect.Type, indent, step string) string {
+	return formatTypeIn(t, indent, step, nil)
+}
+
+// Formats t as formatType does, qualifying named types with the names their packages are imported
+// as in imports, if it is not nil.
+func formatTypeIn(t reflect.Type, indent, step string, imports *importSet) string {
 	switch t.Kind() {
 	case reflect.Array:
-		return fmt.Sprintf("[%d]%s", t.Len(), substAny(t.Elem()))
+		return fmt.Sprintf("[%d]%s", t.Len(), formatTypeIn(t.Elem(), indent, step, imports))
 
 	case reflect.Slice:
-		return "[]" + substAny(t.Elem())
+		return "[]" + formatTypeIn(t.Elem(), indent, step, imports)
 
 	case reflect.Map:
-		return "map[" + substAny(t.Key()) + "]" + substAny(t.Elem())
+		return "map[" + formatTypeIn(t.Key(), indent, step, imports) + "]" + formatTypeIn(t.Elem(), indent, step, imports)
 
 	case reflect.Chan:
-		return fmt.Sprintf("%s %s", t.ChanDir(), substAny(t.Elem()))
+		return fmt.Sprintf("%s %s", t.ChanDir(), formatTypeIn(t.Elem(), indent, step, imports))
+
+	case reflect.Ptr:
+		if t.Name() == "" {
+			return "*" + formatTypeIn(t.Elem(), indent, step, imports)
+		}
+
+	case reflect.Struct:
+		if t.Name() == "" {
+			return formatStructType(t, indent, step, imports)
+		}
 
 	case reflect.Func:
+		if t.Name() != "" {
+			break
+		}
 		in := []string{}
 		out := []string{}
 		for i := 0; i < t.NumIn(); i++ {
-			in = append(in, substAny(t.In(i)))
+			in = append(in, formatTypeIn(t.In(i), indent, step, imports))
 		}
 		for i := 0; i < t.NumOut(); i++ {
-			out = append(out, substAny(t.Out(i)))
+			out = append(out, formatTypeIn(t.Out(i), indent, step, imports))
 		}
 		if len(out) == 0 {
-			return "func" + t.Name() + "(" + strings.Join(in, ", ") + ")"
+			return "func(" + strings.Join(in, ", ") + ")"
 		}
-		return "func" + t.Name() + "(" + strings.Join(in, ", ") + ") (" + strings.Join(out, ", ") + ")"
+		return "func(" + strings.Join(in, ", ") + ") (" + strings.Join(out, ", ") + ")"
 	}
 
 	if t == anyType {
 		return "any"
 	}
+	if imports != nil {
+		return imports.typeName(t)
+	}
 	return t.String()
 }
+
+func formatStructType(t reflect.Type, indent, step string, imports *importSet) string {
+	if t.NumField() == 0 {
+		return "struct {}"
+	}
+	fields := make([]string, t.NumField())
+	for i := range fields {
+		f := t.Field(i)
+		field := formatTypeIn(f.Type, indent+step, step, imports)
+		if !f.Anonymous {
+			field = f.Name + " " + field
+		}
+		if f.Tag != "" {
+			field += " " + strconv.Quote(string(f.Tag))
+		}
+		fields[i] = field
+	}
+	if step == "" {
+		return "struct { " + strings.Join(fields, "; ") + " }"
+	}
+	return "struct {\n" + indent + step + strings.Join(fields, "\n"+indent+step) + "\n" + indent + "}"
+}
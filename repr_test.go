@@ -1,12 +1,28 @@
 package repr
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"go/token"
+	htmltemplate "html/template"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	texttemplate "text/template"
 	"time"
+	"unsafe"
 )
 
 func equal(t *testing.T, want, have string) {
@@ -57,6 +73,15 @@ func TestReprEmptySliceMapFields(t *testing.T) {
 	equal(t, `struct { S []string; M map[string]string; NZ []string }{NZ: []string{"a", "b"}}`, String(v, OmitEmpty(true)))
 }
 
+func TestEmptyPlaceholder(t *testing.T) {
+	type cfg struct{ Name string }
+	equal(t, "", String(map[string]int{}, EmptyPlaceholder("")))
+	equal(t, "<empty>", String(cfg{}, EmptyPlaceholder("<empty>")))
+	equal(t, "<empty>", String(nil, EmptyPlaceholder("<empty>")))
+	equal(t, "[]int{1}", String([]int{1}, EmptyPlaceholder("")))
+	equal(t, "repr.cfg{}", String(cfg{}))
+}
+
 func TestReprStringArray(t *testing.T) {
 	equal(t, "[]string{\"a\", \"b\"}", String([]string{"a", "b"}))
 }
@@ -120,6 +145,12 @@ func TestReprStructWithIndent(t *testing.T) {
 func TestReprByteArray(t *testing.T) {
 	b := []byte{1, 2, 3}
 	equal(t, "[]byte(\"\\x01\\x02\\x03\")", String(b))
+	equal(t, "[]byte{0x01, 0x02, 0x03}", String(b, LayoutVersion(4)))
+	equal(t, "[]byte(\"\\x01\\x02\\x03\")", String(b, Bytes(BytesString), LayoutVersion(4)))
+	equal(t, "[]byte(\"héllo\\n\")", String([]byte("héllo\n"), LayoutVersion(4)))
+	equal(t, "[]byte{0x68, 0x69}", String([]byte("hi"), Bytes(BytesHex)))
+	equal(t, "[]byte(\"\")", String([]byte{}, LayoutVersion(4)))
+	equal(t, "[]byte{0xff, 0x61}", String([]byte{0xff, 'a'}, LayoutVersion(4)))
 }
 
 type privateTestStruct struct {
@@ -229,6 +260,93 @@ func TestRecursiveIssue3(t *testing.T) {
 	equal(t, want, have)
 }
 
+func TestSharedPointerToUnexportedStruct(t *testing.T) {
+	type inner struct{ N int }
+	type outer struct{ in inner }
+	v := &outer{in: inner{N: 1}}
+	equal(t, "[]*repr.outer{{in: repr.inner{N: 1}}, {in: repr.inner{N: 1}}}", String([]*outer{v, v}))
+}
+
+func TestCyclePath(t *testing.T) {
+	type node struct {
+		Name     string
+		Children []*node
+		Up       *node
+	}
+	root := &node{Name: "root"}
+	mid := &node{Name: "mid", Up: root}
+	leaf := &node{Name: "leaf"}
+	leaf.Up = mid
+	mid.Children = []*node{leaf}
+	root.Children = []*node{mid}
+	equal(t, `&repr.node{Name: "root", Children: []*repr.node{{Name: "mid", Children: []*repr.node{`+
+		`{Name: "leaf", Up: /* cycle to Children[0] */}}, Up: /* cycle to <root> */}}}`, String(root, LayoutVersion(3)))
+	m := map[string]any{}
+	m["self"] = m
+	equal(t, `map[string]any{"self": /* cycle to <root> */}`, String(m, LayoutVersion(3)))
+	equal(t, `map[string]any{"self": ...}`, String(m))
+}
+
+func TestUseMarkers(t *testing.T) {
+	type node struct {
+		Secret string
+		Next   *node
+		Fn     func()
+	}
+	v := &node{Secret: "hunter2"}
+	v.Next = v
+	markers := UseMarkers(Markers{Cycle: "<-", Hidden: "hidden"})
+	equal(t, `&repr.node{Secret: /* hidden */, Next: /* <- <root> */}`, String(v, markers, HideField("Secret"), LayoutVersion(3)))
+	equal(t, `&repr.node{Next: /* cycle to <root> */}`, String(v, HideField("Secret"), LayoutVersion(3)))
+	// An explicit Cycle marker applies at every layout version, unlike the default.
+	equal(t, `&repr.node{Secret: /* hidden */, Next: /* <- <root> */}`, String(v, markers, HideField("Secret")))
+	equal(t, `&repr.node{Secret: /* hidden */, Next: &...}`, String(v, UseMarkers(Markers{Hidden: "hidden"}), HideField("Secret")))
+	v.Fn = func() {}
+	equal(t, `&repr.node{Next: nil /* <- <root> */, Fn: nil /* func elided */}`, String(v, markers, HideField("Secret"), StrictGo(), LayoutVersion(3)))
+	markers = UseMarkers(Markers{More: "further", Elided: "…", Func: "fn", Invalid: "gone", Unexported: "private"})
+	equal(t, `repr.node{Secret: "hun" /* 4 further bytes */, Next: &repr.node{…}}`,
+		String(node{Secret: "hunter2", Next: &node{Secret: "b"}}, markers, FieldBudget("Secret", 3), Shallow()))
+	equal(t, `&repr.node{Secret: "hunter2", Next: nil /* cycle */, Fn: nil /* fn */}`, String(v, markers, StrictGo()))
+	equal(t, `nil /* 1 element, type repr.node private */`, String([]node{{}}, markers, StrictGo()))
+	equal(t, `[]any{nil /* private type repr.node */}`, String([]any{node{}}, markers, StrictGo()))
+	deletingMap = map[DeletingKey]int{"a": 1, "b": 2}
+	equal(t, `map[repr.DeletingKey]int{"a": 1, "b": /* gone */}`, String(deletingMap, markers))
+}
+
+func TestShowAddresses(t *testing.T) {
+	type node struct {
+		Name        string
+		Left, Right *node
+	}
+	shared := &node{Name: "shared"}
+	root := &node{Name: "root", Left: shared, Right: shared}
+	equal(t, `/* p1 */ &repr.node{Name: "root", Left: /* p2 */ &repr.node{Name: "shared"}, `+
+		`Right: /* p2 */ &repr.node{Name: "shared"}}`, String(root, StableAddresses()))
+	equal(t, `[]*int{/* p1 */ 1, /* p1 */ 1, nil}`, String(func() []*int { n := 1; return []*int{&n, &n, nil} }(), StableAddresses()))
+	have := String(shared, ShowAddresses())
+	equal(t, fmt.Sprintf(`/* %p */ &repr.node{Name: "shared"}`, shared), have)
+	equal(t, `/* p1 */ &repr.node{Name: "shared"}`, String(shared, ShowAddresses(), Deterministic()))
+	equal(t, `/* p1 */ &repr.node{Name: "shared"}`, String(shared, Deterministic(), ShowAddresses()))
+	equal(t, `&repr.node{Name: "shared"}`, String(shared, Deterministic()))
+}
+
+func TestUnrollCycles(t *testing.T) {
+	type node struct {
+		Name       string
+		Prev, Next *node
+	}
+	a := &node{Name: "a"}
+	b := &node{Name: "b", Prev: a}
+	a.Next = b
+	equal(t, `&repr.node{Name: "a", Next: &repr.node{Name: "b", Prev: &...}}`, String(a))
+	equal(t, `&repr.node{Name: "a", Next: &repr.node{Name: "b", Prev: &repr.node{Name: "a", `+
+		`Next: &repr.node{Name: "b", Prev: /* cycle to Next.Prev */}}}}`,
+		String(a, UnrollCycles(1), LayoutVersion(3)))
+	equal(t, `&repr.node{Name: "a", Next: &repr.node{Name: "b", Prev: &repr.node{Name: "a", `+
+		`Next: &repr.node{Name: "b", Prev: nil /* cycle to Next.Prev */}}}}`,
+		String(a, UnrollCycles(1), StrictGo(), LayoutVersion(3)))
+}
+
 type MyBuffer struct {
 	buf *bytes.Buffer
 }
@@ -265,3 +383,1972 @@ func TestScalarLiterals(t *testing.T) {
 	d := time.Second
 	equal(t, "time.Duration(1000000000)", String(d, ScalarLiterals()))
 }
+
+type namedRendererType struct {
+	ID string
+}
+
+func TestRegisterTypeName(t *testing.T) {
+	RegisterTypeName("github.com/alecthomas/repr.namedRendererType", func(v reflect.Value) string {
+		return fmt.Sprintf("mustParse(%q)", v.Field(0).String())
+	})
+	equal(t, `mustParse("abc")`, String(namedRendererType{"abc"}))
+	equal(t, `[]repr.namedRendererType{mustParse("abc")}`, String([]namedRendererType{{"abc"}}))
+}
+
+func TestStripVendor(t *testing.T) {
+	equal(t, "github.com/google/uuid", stripVendor("github.com/google/uuid"))
+	equal(t, "github.com/google/uuid", stripVendor("vendor/github.com/google/uuid"))
+	equal(t, "github.com/google/uuid", stripVendor("example.com/app/vendor/github.com/google/uuid"))
+}
+
+type constructedType struct {
+	n int
+}
+
+func TestRegisterConstructor(t *testing.T) {
+	RegisterConstructor(func(v constructedType) string { return fmt.Sprintf("newConstructed(%d)", v.n) })
+	equal(t, "newConstructed(1)", String(constructedType{1}))
+	equal(t, "map[string]repr.constructedType{\"a\": newConstructed(2)}", String(map[string]constructedType{"a": {2}}))
+}
+
+type registeredLevel int8
+
+func (l registeredLevel) String() string { return [...]string{"DEBUG", "INFO"}[l] }
+
+func TestRegisterValue(t *testing.T) {
+	RegisterValue(registeredLevel(1), "log.LevelInfo")
+	equal(t, "log.LevelInfo", String(registeredLevel(1)))
+	equal(t, "[]repr.registeredLevel{repr.registeredLevel(DEBUG), log.LevelInfo}", String([]registeredLevel{0, 1}))
+	equal(t, "log.LevelInfo", String(registeredLevel(1), StrictGo()))
+}
+
+type registeredAny struct{ V any }
+
+func TestRegisterValueUnhashable(t *testing.T) {
+	// RegisterValue(registeredAny{1}, "one"), which only compiles from Go 1.20.
+	registryLock.Lock()
+	valueExprs[reflect.TypeOf(registeredAny{})] = map[any]string{registeredAny{1}: "one"}
+	registryLock.Unlock()
+	equal(t, "one", String(registeredAny{1}))
+	equal(t, "repr.registeredAny{V: []int{1}}", String(registeredAny{[]int{1}}))
+	equal(t, "repr.registeredAny{V: map[string]int{\"a\": 1}}", String(registeredAny{map[string]int{"a": 1}}))
+}
+
+func TestReprTime(t *testing.T) {
+	v := struct{ T time.Time }{time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)}
+	equal(t, "struct { T time.Time }{T: time.Date(2020, time.January, 2, 3, 4, 5, 6, time.UTC)}", String(v))
+	equal(t, "struct { T time.Time }{T: time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)}", String(v, IgnoreGoStringer()))
+}
+
+func TestStrictGo(t *testing.T) {
+	i := 13
+	equal(t, "func() *int { var v int = 13; return &v }()", String(&i, StrictGo()))
+	equal(t, "[]*int{func() *int { var v int = 13; return &v }(), nil}", String([]*int{&i, nil}, StrictGo()))
+	equal(t, "time.Duration(1000000000)", String(time.Second, StrictGo()))
+	equal(t, "[]float64{float64(math.NaN()), float64(math.Inf(1)), 1.5}", String([]float64{math.NaN(), math.Inf(1), 1.5}, StrictGo()))
+	type data struct{ parent *data }
+	d := &data{}
+	d.parent = d
+	equal(t, "&repr.data{parent: nil /* cycle */}", String(d, StrictGo()))
+	equal(t, "&repr.data{parent: nil /* cycle to <root> */}", String(d, StrictGo(), LayoutVersion(3)))
+}
+
+type brokenGoStringer struct{ A int }
+
+func (brokenGoStringer) GoString() string { panic("broken") }
+
+type brokenStringer int
+
+func (brokenStringer) String() string { panic("broken") }
+
+func TestSafe(t *testing.T) {
+	s, err := Safe(brokenGoStringer{A: 1})
+	equal(t, "repr.brokenGoStringer{A: 1}", s)
+	equal(t, "repr: repr.brokenGoStringer.GoString() panicked: broken", fmt.Sprint(err))
+
+	s, err = Safe([]brokenStringer{1})
+	equal(t, "[]repr.brokenStringer{repr.brokenStringer(1)}", s)
+	if err == nil {
+		t.Error("expected an error")
+	}
+
+	var nilStringer *brokenGoStringer
+	s, err = Safe([]any{nil, nilStringer, reflect.Value{}})
+	equal(t, "[]any{nil, (*repr.brokenGoStringer)(nil), reflect.Value{}}", s)
+	equal(t, "<nil>", fmt.Sprint(err))
+}
+
+type pseudoGoStringer struct{ ID int }
+
+func (p pseudoGoStringer) GoString() string { return fmt.Sprintf("<item #%d>", p.ID) }
+
+type validGoStringer struct{ ID int }
+
+func (p validGoStringer) GoString() string { return fmt.Sprintf("item(%d)", p.ID) }
+
+func TestValidateGoString(t *testing.T) {
+	var warnings []string
+	onWarning := OnWarning(func(path, reason string) { warnings = append(warnings, path+": "+reason) })
+	equal(t, "[]repr.pseudoGoStringer{<item #1>}", String([]pseudoGoStringer{{1}}))
+	equal(t, "[]repr.pseudoGoStringer{{ID: 1}}", String([]pseudoGoStringer{{1}}, ValidateGoString(), onWarning))
+	equal(t, `[0]: repr.pseudoGoStringer.GoString() returned invalid expression "<item #1>"`, strings.Join(warnings, ", "))
+	equal(t, "item(2)", String(validGoStringer{2}, ValidateGoString()))
+}
+
+type hiddenItem struct{ N int }
+
+type HiddenItems struct {
+	Name   string
+	Array  [2]*hiddenItem
+	Struct struct{ Item hiddenItem }
+	Map    map[string]hiddenItem
+}
+
+func TestStrictGoUnexportedElements(t *testing.T) {
+	w := &strings.Builder{}
+	err := New(w, NoIndent()).PrintStrict([]hiddenItem{{1}, {2}})
+	equal(t, "nil /* 2 elements, type repr.hiddenItem unexported */", w.String())
+	equal(t, "repr: unrepresentable values: <root>: unexported type repr.hiddenItem can not be represented", fmt.Sprint(err))
+	equal(t, "nil /* 1 element, type repr.hiddenItem unexported */", String([]hiddenItem{{1}}, StrictGo()))
+	equal(t, "{/* 2 elements, type repr.hiddenItem unexported */}", String([2]*hiddenItem{}, StrictGo()))
+	equal(t, "nil /* 1 entry, type repr.hiddenItem unexported */", String(map[hiddenItem]int{{1}: 1}, StrictGo()))
+	equal(t, "{/* type repr.hiddenItem unexported */}", String(struct{ A hiddenItem }{}, StrictGo()))
+	w.Reset()
+	err = New(w, NoIndent(), OmitEmpty(false)).PrintStrict(HiddenItems{Name: "a", Map: map[string]hiddenItem{"b": {2}}})
+	equal(t, `repr.HiddenItems{Name: "a", Map: nil /* 1 entry, type repr.hiddenItem unexported */}`, w.String())
+	equal(t, "repr: unrepresentable values: Array: unexported type repr.hiddenItem can not be represented; "+
+		"Struct: unexported type repr.hiddenItem can not be represented; Map: unexported type repr.hiddenItem can not be represented", fmt.Sprint(err))
+	equal(t, "[]repr.hiddenItem{{N: 1}}", String([]hiddenItem{{1}}))
+	equal(t, "repr.hiddenItem{N: 1}", String(hiddenItem{1}, StrictGo()))
+}
+
+func TestStrictGoPointerToPointer(t *testing.T) {
+	i := 5
+	pi := &i
+	equal(t, "func() **int { var v *int = func() *int { var v int = 5; return &v }(); return &v }()", String(&pi, StrictGo()))
+	var nilPtr *int
+	equal(t, "new(*int)", String(&nilPtr, StrictGo()))
+	zero := 0
+	equal(t, "new(int)", String(&zero, StrictGo()))
+	tm := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	equal(t, "func() *time.Time { var v time.Time = time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC); return &v }()", String(&tm, StrictGo()))
+	s := &privateTestStruct{"a"}
+	equal(t, `func() **repr.privateTestStruct { var v *repr.privateTestStruct = &repr.privateTestStruct{a: "a"}; return &v }()`, String(&s, StrictGo()))
+}
+
+func TestIndexComments(t *testing.T) {
+	equal(t, "[]int{/* [0] */ 1, 2, /* [2] */ 3, 4, /* [4] */ 5}", String([]int{1, 2, 3, 4, 5}, IndexComments(2)))
+	equal(t, "[2]string{\n  /* [0] */ \"a\",\n  \"b\",\n}", String([2]string{"a", "b"}, Indent("  "), IndexComments(2)))
+}
+
+func TestTypeOf(t *testing.T) {
+	pi := new(int)
+	equal(t, "*repr.testStruct{S: string, I: *int, A: repr.anotherStruct{A: []int}}", TypeOf(&testStruct{I: pi}))
+	decoded := map[string]any{
+		"name":   "test",
+		"tags":   []any{"a", "b", 1.0},
+		"nested": map[string]any{"ok": true},
+		"none":   nil,
+	}
+	equal(t, `map[string]any{"name": string, "nested": map[string]any{"ok": bool}, "none": any, "tags": []any{string, float64}}`, TypeOf(decoded))
+	equal(t, "map[string]int", TypeOf(map[string]int{"a": 1}))
+	equal(t, strings.TrimSpace(`
+[]any{
+  []int,
+  map[string]any{
+    "a": string,
+    "b": float64,
+  },
+}
+`), TypeOf([]any{[]int{1}, map[string]any{"a": "x", "b": 1.0}}, Indent("  ")))
+	equal(t, "struct { T time.Time; V repr.validGoStringer }{T: time.Time, V: repr.validGoStringer}", TypeOf(struct {
+		T time.Time
+		V validGoStringer
+	}{}))
+	equal(t, "struct { T time.Time }{T: time.Time}", TypeOf(struct{ T time.Time }{}, IgnoreGoStringer()))
+}
+
+func TestInferStruct(t *testing.T) {
+	decoded := map[string]any{
+		"user_id":   1.0,
+		"firstName": "Alice",
+		"url":       "https://example.com",
+		"tags":      []any{"a", "b"},
+		"address":   map[string]any{"city": "Sydney"},
+		"items":     []any{map[string]any{"id": "a"}, map[string]any{"id": "b", "count": 2.0}},
+		"mixed":     []any{"a", 1.0},
+		"nothing":   nil,
+		"2fa":       true,
+	}
+	equal(t, "type User struct {\n"+
+		"\tF2fa    bool `json:\"2fa\"`\n"+
+		"\tAddress struct {\n"+
+		"\t\tCity string `json:\"city\"`\n"+
+		"\t} `json:\"address\"`\n"+
+		"\tFirstName string `json:\"firstName\"`\n"+
+		"\tItems     []struct {\n"+
+		"\t\tID    string  `json:\"id\"`\n"+
+		"\t\tCount float64 `json:\"count\"`\n"+
+		"\t} `json:\"items\"`\n"+
+		"\tMixed   []any    `json:\"mixed\"`\n"+
+		"\tNothing any      `json:\"nothing\"`\n"+
+		"\tTags    []string `json:\"tags\"`\n"+
+		"\tURL     string   `json:\"url\"`\n"+
+		"\tUserID  float64  `json:\"user_id\"`\n"+
+		"}", InferStruct("User", decoded))
+}
+
+func TestFieldName(t *testing.T) {
+	for key, want := range map[string]string{
+		"user_id":    "UserID",
+		"firstName":  "FirstName",
+		"HTTPServer": "HTTPServer",
+		"api-key":    "APIKey",
+		"":           "F",
+	} {
+		equal(t, want, fieldName(key))
+	}
+}
+
+func TestPrintSlice(t *testing.T) {
+	w := &strings.Builder{}
+	New(w, NoIndent()).PrintSlice([]any{1, "a", anotherStruct{}})
+	equal(t, "int(1)\n---\n\"a\"\n---\nrepr.anotherStruct{}\n", w.String())
+	w.Reset()
+	New(w, RecordSeparator("%%")).PrintSlice([][]int{{1}, {2}})
+	equal(t, "[]int{\n  1,\n}\n%%\n[]int{\n  2,\n}\n", w.String())
+}
+
+func TestSeparator(t *testing.T) {
+	w := &strings.Builder{}
+	New(w, NoIndent()).Println(1, "a")
+	equal(t, "1 \"a\"\n", w.String())
+	w.Reset()
+	New(w, NoIndent(), Separator(",\n")).Print(1, "a")
+	equal(t, "1,\n\"a\"", w.String())
+}
+
+func TestParenthesizeNegative(t *testing.T) {
+	equal(t, "[]int{(-5), 5}", String([]int{-5, 5}, ParenthesizeNegative()))
+	equal(t, "[]float64{(-1.5)}", String([]float64{-1.5}, ParenthesizeNegative()))
+	equal(t, "[]any{int(-5)}", String([]any{-5}, ParenthesizeNegative()))
+	equal(t, "time.Duration(-1s)", String(-time.Second, ParenthesizeNegative()))
+	equal(t, "time.Duration(-1000000000)", String(-time.Second, ParenthesizeNegative(), ScalarLiterals()))
+}
+
+func TestReprUintptr(t *testing.T) {
+	x := 1
+	v := struct {
+		U uintptr
+		P unsafe.Pointer
+	}{0xc000123400, unsafe.Pointer(&x)}
+	if unsafe.Sizeof(uintptr(0)) == 8 {
+		have := String(v)
+		equal(t, "struct { U uintptr; P unsafe.Pointer }{U: 0x000000c000123400, P: unsafe.Pointer(0x", have[:82])
+		equal(t, fmt.Sprintf("0x%016x)}", uintptr(unsafe.Pointer(&x))), have[80:])
+		equal(t, "struct { U uintptr; P unsafe.Pointer }{U: 0x0000000000000000, P: unsafe.Pointer(0x0000000000000000)}", String(v, ZeroUintptrs()))
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	type key struct{ N int }
+	m := map[*key]int{}
+	for i := 9; i >= 0; i-- {
+		m[&key{i}] = i
+	}
+	want := String(m, Deterministic())
+	equal(t, "map[*repr.key]int{{N: 1}: 1, {N: 2}: 2, {N: 3}: 3, {N: 4}: 4, {N: 5}: 5, {N: 6}: 6, {N: 7}: 7, {N: 8}: 8, {N: 9}: 9, {}: 0}", want)
+	equal(t, "make(chan int)", String(make(chan int, 5), Deterministic()))
+	equal(t, "time.Date(2020, time.January, 2, 3, 4, 5, 0, time.Local)", String(time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local), Deterministic()))
+}
+
+func TestLoadLocations(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	v := time.Date(2020, 1, 2, 3, 4, 5, 0, loc)
+	equal(t, `time.Date(2020, time.January, 2, 3, 4, 5, 0, time.Location("Europe/Berlin"))`, String(v))
+	equal(t, `time.Date(2020, 1, 2, 3, 4, 5, 0, func() *time.Location { l, _ := time.LoadLocation("Europe/Berlin"); return l }())`, String(v, LoadLocations()))
+	equal(t, `time.Date(2020, 1, 2, 3, 4, 5, 0, time.FixedZone("X", 60))`, String(time.Date(2020, 1, 2, 3, 4, 5, 0, time.FixedZone("X", 60)), LoadLocations()))
+}
+
+type hiddenImpl struct{ A int }
+
+func (hiddenImpl) String() string { return "hidden" }
+
+func TestStrictGoUnexportedInterfaceValue(t *testing.T) {
+	v := []fmt.Stringer{hiddenImpl{1}, &hiddenImpl{2}, Enum(1)}
+	equal(t, "[]fmt.Stringer{nil /* unexported type repr.hiddenImpl */, nil /* unexported type *repr.hiddenImpl */, repr.Enum(1)}", String(v, StrictGo()))
+	_, err := Safe(v, StrictGo())
+	equal(t, "repr: unexported type repr.hiddenImpl can not be represented; unexported type *repr.hiddenImpl can not be represented", fmt.Sprint(err))
+	RegisterConstructor(func(v hiddenImpl) string { return fmt.Sprintf("otherpkg.NewImpl(%d)", v.A) })
+	equal(t, "[]fmt.Stringer{otherpkg.NewImpl(1), nil /* unexported type *repr.hiddenImpl */, repr.Enum(1)}", String(v, StrictGo()))
+}
+
+func TestHideFuncs(t *testing.T) {
+	type config struct {
+		Name     string
+		Callback func()
+		Any      any
+	}
+	v := config{Name: "a", Callback: func() {}, Any: func(int) {}}
+	equal(t, `repr.config{Name: "a", Callback: func(), Any: func(int)}`, String(v))
+	equal(t, `repr.config{Name: "a"}`, String(v, HideFuncs()))
+	equal(t, `repr.config{Name: "a", Callback: nil /* func elided */, Any: nil /* func elided */}`, String(v, StrictGo()))
+	equal(t, `map[string]any{"b": int(1)}`, String(map[string]any{"a": func() {}, "b": 1}, HideFuncs()))
+	equal(t, `[]func(){nil}`, String([]func(){func() {}}, HideFuncs()))
+}
+
+func TestChannels(t *testing.T) {
+	type pipe struct {
+		Name string
+		In   <-chan int
+	}
+	v := pipe{Name: "a", In: make(chan int, 1)}
+	equal(t, `repr.pipe{Name: "a", In: make(<-chan int, 1)}`, String(v, Channels(ChanMake)))
+	equal(t, `repr.pipe{Name: "a", In: nil}`, String(v, Channels(ChanNil)))
+	equal(t, `repr.pipe{Name: "a"}`, String(v, Channels(ChanOmit)))
+	equal(t, `[]chan int{nil}`, String([]chan int{make(chan int)}, Channels(ChanOmit)))
+}
+
+type intSeq func(yield func(int) bool)
+
+func TestMaterializeIterators(t *testing.T) {
+	naturals := intSeq(func(yield func(int) bool) {
+		for i := 0; yield(i); i++ {
+		}
+	})
+	pairs := func(yield func(string, int) bool) {
+		_ = yield("a", 1) && yield("b", 2)
+	}
+	broken := func(yield func(int) bool) { panic("boom") }
+	equal(t, `repr.intSeq`, String(naturals))
+	equal(t, `repr.intSeq{0, 1, 2, /* more elided */}`, String(naturals, MaterializeIterators(3)))
+	equal(t, "repr.intSeq{\n  0,\n  1,\n  /* more elided */\n}", String(naturals, MaterializeIterators(2), Indent("  ")))
+	equal(t, `repr.intSeq{0, 1, 2, /* truncated */}`, String(naturals, MaterializeIterators(3), LayoutVersion(6)))
+	equal(t, `repr.intSeq{0, /* cut */}`, String(naturals, MaterializeIterators(1), LayoutVersion(6), UseMarkers(Markers{Truncated: "cut"})))
+	equal(t, `func(func(string, int) (bool)){"a": 1, "b": 2}`, String(pairs, MaterializeIterators(10)))
+	var warnings []string
+	onWarning := OnWarning(func(path, reason string) { warnings = append(warnings, path+": "+reason) })
+	equal(t, `func(func(int) (bool))`, String(broken, MaterializeIterators(10), onWarning))
+	equal(t, "<root>: iterator func(func(int) bool) panicked: boom", strings.Join(warnings, ", "))
+	equal(t, `nil /* func elided */`, String(naturals, MaterializeIterators(3), StrictGo()))
+}
+
+func TestChanInfo(t *testing.T) {
+	type pipe struct {
+		In   <-chan int64
+		Out  chan<- [2048]byte
+		Both chan struct{}
+	}
+	v := pipe{In: make(chan int64), Out: make(chan [2048]byte, 2), Both: make(chan struct{})}
+	equal(t, `repr.pipe{In: make(<-chan int64, 0) /* elem size=8B, dir=recv */, `+
+		`Out: make(chan<- [2048]uint8, 2) /* elem size=2048B, dir=send */, `+
+		`Both: make(chan struct {}, 0) /* elem size=0B, dir=both */}`, String(v, ChanInfo()))
+	equal(t, `repr.pipe{In: nil, Out: nil, Both: nil}`, String(v, ChanInfo(), Channels(ChanNil)))
+}
+
+func TestAnonymousStructType(t *testing.T) {
+	v := struct {
+		A any
+		B struct {
+			C []any `json:"c"`
+		}
+	}{A: 1}
+	equal(t, `struct { A any; B struct { C []any "json:\"c\"" } }{A: int(1)}`, String(v))
+	equal(t, strings.TrimSpace(`
+struct {
+  A any
+  B struct {
+    C []any "json:\"c\""
+  }
+}{
+  A: int(1),
+}
+`), String(v, Indent("  ")))
+	equal(t, "[]*struct { A int }{{A: 1}}", String([]*struct{ A int }{{1}}))
+}
+
+func TestUseJSONNames(t *testing.T) {
+	type user struct {
+		ID       int    `json:"id"`
+		Name     string `json:"name,omitempty"`
+		Password string `json:"-"`
+		Email    string
+	}
+	v := user{ID: 1, Name: "a", Password: "secret", Email: "a@example.com"}
+	equal(t, `repr.user{ID: 1, Name: "a", Password: "secret", Email: "a@example.com"}`, String(v))
+	equal(t, `repr.user{id: 1, name: "a", Email: "a@example.com"}`, String(v, UseJSONNames()))
+	equal(t, `repr.user{ID: 1, Password: "secret"}`, String(v, HideField("name", "Email")))
+	equal(t, `repr.user{id: 1}`, String(v, UseJSONNames(), HideField("Name", "Email")))
+	equal(t, `repr.user{id: int, name: string, Email: string}`, TypeOf(v, UseJSONNames()))
+}
+
+func TestOmitNil(t *testing.T) {
+	v := struct {
+		N  int
+		P  *int
+		I  any
+		S  []string
+		ES []string
+		M  map[string]int
+		EM map[string]int
+	}{ES: []string{}, EM: map[string]int{}}
+	equal(t, `struct { N int; P *int; I any; S []string; ES []string; M map[string]int; EM map[string]int }{N: 0, ES: []string{}, EM: map[string]int{}}`, String(v, OmitNil()))
+}
+
+func TestNilAndEmpty(t *testing.T) {
+	type lists struct {
+		Nil   []int
+		Empty []int
+		NilM  map[string]int
+		EmpM  map[string]int
+	}
+	v := lists{Empty: []int{}, EmpM: map[string]int{}}
+	equal(t, "repr.lists{}", String(v))
+	equal(t, "repr.lists{Nil: nil, Empty: []int{}, NilM: nil, EmpM: map[string]int{}}", String(v, OmitEmpty(false)))
+	equal(t, "repr.lists{\n  Nil: nil,\n  Empty: []int{},\n  NilM: nil,\n  EmpM: map[string]int{},\n}", String(v, OmitEmpty(false), Indent("  ")))
+	equal(t, "repr.lists{Nil: []int{}, Empty: []int{}, NilM: map[string]int{}, EmpM: map[string]int{}}", String(v, OmitEmpty(false), NilAsEmpty()))
+	equal(t, "repr.lists{Nil: nil, Empty: nil, NilM: nil, EmpM: nil}", String(v, OmitEmpty(false), EmptyAsNil()))
+	equal(t, "[][]int{nil, []int{}}", String([][]int{nil, {}}))
+	equal(t, "[]any{[]int(nil), []int{}, (*int)(nil), nil}", String([]any{[]int(nil), []int{}, (*int)(nil), nil}))
+	equal(t, "nil", String([]int(nil)))
+	equal(t, "[]int{}", String([]int(nil), NilAsEmpty()))
+}
+
+func TestPreserveCapacity(t *testing.T) {
+	equal(t, "append(make([]int, 0, 64), []int{1, 2}...)", String(append(make([]int, 0, 64), 1, 2), PreserveCapacity()))
+	equal(t, "make([]string, 0, 8)", String(make([]string, 0, 8), PreserveCapacity()))
+	equal(t, "[]int{1, 2}", String(append(make([]int, 0, 4), 1, 2), PreserveCapacity()))
+	equal(t, "[]int{1, 2}", String(append(make([]int, 0, 64), 1, 2)))
+	equal(t, "struct { B []uint8 }{B: append(make([]uint8, 0, 16), []byte(\"hi\")...)}",
+		String(struct{ B []byte }{append(make([]byte, 0, 16), "hi"...)}, PreserveCapacity(), Bytes(BytesString)))
+	equal(t, "append(make([][]int, 0, 3), [][]int{\n  append(make([]int, 0, 3), []int{\n    1,\n  }...),\n}...)",
+		String(append(make([][]int, 0, 3), append(make([]int, 0, 3), 1)), PreserveCapacity(), Indent("  ")))
+}
+
+type anything interface{}
+
+func TestReprNestedAnyTypes(t *testing.T) {
+	decoded := []any{map[string]any{"a": []any{1.0, "x", true, nil, map[string]any{"n": 2.0}}}}
+	equal(t, `[]any{map[string]any{"a": []any{float64(1), "x", bool(true), nil, map[string]any{"n": float64(2)}}}}`, String(decoded))
+	equal(t, `[]repr.anything{float64(1), int8(2), []any{float64(3)}}`, String([]anything{1.0, int8(2), []any{3.0}}))
+	equal(t, `map[repr.anything]any{int(1): uint(2)}`, String(map[anything]any{1: uint(2)}))
+	i := int8(2)
+	equal(t, `[]any{&int8(2)}`, String([]any{&i}))
+}
+
+func TestSortSlices(t *testing.T) {
+	byString := SortSlices(func(a, b reflect.Value) bool { return fmt.Sprint(a) < fmt.Sprint(b) })
+	v := []int{3, 1, 2}
+	equal(t, "[]int{1, 2, 3}", String(v, byString))
+	equal(t, "[]int{3, 1, 2}", String(v))
+	equal(t, `[][]string{[]string{"a", "b"}, []string{"c"}}`, String([][]string{{"c"}, {"b", "a"}}, byString, ExplicitTypes(true)))
+}
+
+func TestCanonical(t *testing.T) {
+	type item struct {
+		Tags []string
+		N    int
+	}
+	a := []item{{Tags: []string{"b", "a"}, N: 2}, {N: 1}}
+	b := []item{{N: 1}, {Tags: []string{"a", "b"}, N: 2}}
+	equal(t, `[]repr.item{{N: 1}, {Tags: []string{"a", "b"}, N: 2}}`, String(a, Canonical()))
+	equal(t, String(a, Canonical()), String(b, Canonical()))
+}
+
+func TestNormalize(t *testing.T) {
+	type node struct {
+		Name     string
+		private  []int
+		Children []*node
+		Callback func()
+		Ptr      uintptr
+	}
+	root := &node{Name: "root", private: []int{3, 1, 2}, Callback: func() {}, Ptr: 0x1234}
+	root.Children = []*node{{Name: "b"}, {Name: "a"}, root}
+	normalized := Normalize(root, Canonical(), HideFuncs()).(*node)
+	equal(t, String(root, Canonical(), HideFuncs()), String(normalized, Canonical(), HideFuncs()))
+	equal(t, "[]int{1, 2, 3}", String(normalized.private))
+	equal(t, "a", normalized.Children[1].Name)
+	if normalized.Children[0] != normalized {
+		t.Error("expected cycle to be preserved")
+	}
+	if normalized.Callback != nil {
+		t.Error("expected hidden values to be zeroed")
+	}
+	equal(t, "[]int{3, 1, 2}", String(root.private))
+	equal(t, "time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)", String(Normalize(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))))
+	if Normalize(nil) != nil {
+		t.Error("expected nil")
+	}
+}
+
+func TestNormalizeSharedMapsAndSlices(t *testing.T) {
+	m := map[string]any{"n": 1}
+	m["self"] = m
+	normalized := Normalize(m, Canonical()).(map[string]any)
+	if reflect.ValueOf(normalized["self"]).Pointer() != reflect.ValueOf(normalized).Pointer() {
+		t.Error("expected map cycle to be preserved")
+	}
+	s := []any{1, nil}
+	s[1] = s
+	ns := Normalize(s).([]any)
+	if &ns[1].([]any)[0] != &ns[0] {
+		t.Error("expected slice cycle to be preserved")
+	}
+	shared := []int{2, 1}
+	pair := Normalize([2][]int{shared, shared}, Canonical()).([2][]int)
+	equal(t, "[]int{1, 2}", String(pair[0]))
+	if &pair[0][0] != &pair[1][0] {
+		t.Error("expected shared slice to be shared in the copy")
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	v := []int{1, 2}
+	equal(t, "[]int{\n\t  1,\n\t  2,\n\t}", IndentBy(String(v, Indent("  ")), "\t"))
+	w := &strings.Builder{}
+	p := New(w, Prefix("\t"))
+	p.Println(v)
+	p.Println(v)
+	equal(t, "[]int{\n\t  1,\n\t  2,\n\t}\n\t[]int{\n\t  1,\n\t  2,\n\t}\n", w.String())
+	equal(t, "[]int{\n>  1,\n>  2,\n> }", String(v, Indent(" "), Prefix("> ")))
+}
+
+func TestGoFile(t *testing.T) {
+	type config struct {
+		Name    string
+		Timeout time.Duration
+	}
+	source, err := GoFile("fixtures", "cfg", &config{Name: "foo", Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, `package fixtures
+
+import (
+	"github.com/alecthomas/repr"
+	"time"
+)
+
+var cfg = &repr.config{
+	Name:    "foo",
+	Timeout: time.Duration(1000000000),
+}
+`, string(source))
+}
+
+func TestGoFileInTypesPackage(t *testing.T) {
+	type config struct {
+		Name    string
+		Timeout time.Duration
+		Items   []hiddenItem
+	}
+	source, err := GoFile("repr", "cfg", []*config{{Name: "repr.config", Timeout: time.Second, Items: []hiddenItem{{1}}}}, NoIndent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, `package repr
+
+import (
+	"time"
+)
+
+var cfg = []*config{{Name: "repr.config", Timeout: time.Duration(1000000000), Items: []hiddenItem{{N: 1}}}}
+`, string(source))
+	type pair struct{ A, B hiddenItem }
+	source, err = GoVars("repr", []Var{{Name: "a", Value: pair{hiddenItem{1}, hiddenItem{1}}}}, DedupSubtrees(10), NoIndent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, `package repr
+
+var shared1 = hiddenItem{N: 1}
+
+var a = pair{A: shared1, B: shared1}
+`, string(source))
+}
+
+func TestGoFileImportCollisions(t *testing.T) {
+	// Both packages are named template.
+	page := struct {
+		Body  htmltemplate.HTML
+		Error texttemplate.ExecError
+	}{Body: "<b>", Error: texttemplate.ExecError{Name: "index"}}
+	source, err := GoFile("main", "p", page, NoIndent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, `package main
+
+import (
+	"html/template"
+	template2 "text/template"
+)
+
+var p = struct {
+	Body  template.HTML
+	Error template2.ExecError
+}{Body: template.HTML("<b>"), Error: template2.ExecError{Name: "index"}}
+`, string(source))
+}
+
+// Boxed is exported so that GoFile can refer to it from other packages.
+type Boxed[T any] struct{ Value T }
+
+func TestGoFileTypeArguments(t *testing.T) {
+	source, err := GoFile("main", "b", []Boxed[map[token.Pos]htmltemplate.HTML]{{Value: map[token.Pos]htmltemplate.HTML{1: "a"}}}, NoIndent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, `package main
+
+import (
+	"github.com/alecthomas/repr"
+	"go/token"
+	"html/template"
+)
+
+var b = []repr.Boxed[map[token.Pos]template.HTML]{{Value: map[token.Pos]template.HTML{token.Pos(1): template.HTML("a")}}}
+`, string(source))
+}
+
+func TestGoFileProvenance(t *testing.T) {
+	source, err := GoFile("fixtures", "values", []int{1}, Provenance(), OmitEmpty(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := strings.SplitN(string(source), "package", 2)[0]
+	equal(t, `// Code generated by repr; DO NOT EDIT.
+//
+// type: []int
+// repr: `+version()+`
+// options: StrictGo, Indent, Provenance, OmitEmpty
+
+`, header)
+}
+
+func TestWriteFixtureFile(t *testing.T) {
+	dir := t.TempDir()
+	err := WriteFixtureFile(filepath.Join(dir, "fixture.go"), "fixtures", "values", []int{1, 2}, BuildConstraint("integration"), TestFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := os.ReadFile(filepath.Join(dir, "fixture_test.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, `//go:build integration
+
+package fixtures
+
+var values = []int{
+	1,
+	2,
+}
+`, string(source))
+}
+
+func TestGoVars(t *testing.T) {
+	source, err := GoVars("fixtures", []Var{
+		{Name: "timeout", Value: time.Second},
+		{Name: "deadline", Value: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}, NoIndent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, `package fixtures
+
+import (
+	"time"
+)
+
+var (
+	timeout  = time.Duration(1000000000)
+	deadline = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+)
+`, string(source))
+	source, err = GoVars("fixtures", []Var{
+		{Name: "a", Value: int64(7)},
+		{Name: "b", Value: uint8(3)},
+		{Name: "c", Value: 2.0},
+		{Name: "d", Value: 2.5},
+		{Name: "e", Value: float32(2)},
+		{Name: "f", Value: 7},
+		{Name: "g", Value: Enum(1)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, `package fixtures
+
+import (
+	"github.com/alecthomas/repr"
+)
+
+var (
+	a int64   = 7
+	b uint8   = 0x3
+	c float64 = 2
+	d         = 2.5
+	e float32 = 2
+	f         = 7
+	g         = repr.Enum(1)
+)
+`, string(source))
+}
+
+func TestWriteFixtureFiles(t *testing.T) {
+	dir := t.TempDir()
+	err := WriteFixtureFiles(dir, "fixtures", map[string]any{"First": 1, "Second": "two"},
+		func(name string) string { return "fixture_" + strings.ToLower(name) + ".go" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := os.ReadFile(filepath.Join(dir, "fixture_second.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "package fixtures\n\nvar Second = \"two\"\n", string(source))
+	_, err = os.Stat(filepath.Join(dir, "fixture_first.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+type strictImpl struct{}
+
+func TestPrintStrict(t *testing.T) {
+	type node struct {
+		Next    *node
+		Handler func()
+		Values  map[string][]any
+		Events  chan int
+	}
+	events := make(chan int, 1)
+	events <- 1
+	n := &node{Handler: func() {}, Values: map[string][]any{"key": {strictImpl{}}}, Events: events}
+	n.Next = n
+	w := &bytes.Buffer{}
+	err := New(w, NoIndent()).PrintStrict(n)
+	var uerr *UnrepresentableError
+	if !errors.As(err, &uerr) {
+		t.Fatalf("expected UnrepresentableError, got %v", err)
+	}
+	equal(t, `repr: unrepresentable values: Next: cycle; Handler: func elided; `+
+		`Values["key"][0]: unexported type repr.strictImpl can not be represented; Events: channel contents elided`, err.Error())
+	equal(t, "Handler", uerr.Values[1].Path)
+	err = New(w).PrintStrict(func() {})
+	equal(t, `repr: unrepresentable values: <root>: func elided`, err.Error())
+	if err := New(w).PrintStrict(1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOnWarning(t *testing.T) {
+	type node struct {
+		Next     *node
+		Callback func()
+	}
+	n := &node{Callback: func() {}}
+	n.Next = n
+	var warnings []string
+	onWarning := OnWarning(func(path, reason string) { warnings = append(warnings, path+": "+reason) })
+	String(n, onWarning)
+	equal(t, "Next: cycle, Callback: func rendered as its type", strings.Join(warnings, ", "))
+	warnings = nil
+	String(map[string]func(){"f": nil, "g": func() {}}, onWarning)
+	equal(t, `["g"]: func rendered as its type`, strings.Join(warnings, ", "))
+	warnings = nil
+	// Keys held in interfaces are distinguishable, and match the paths printed by Flatten.
+	keys := map[any]func(){1: func() {}, "1": func() {}, nil: func() {}}
+	String(keys, onWarning)
+	equal(t, `[int(1)]: func rendered as its type, ["1"]: func rendered as its type, [nil]: func rendered as its type`, strings.Join(warnings, ", "))
+	equal(t, "[int(1)] = func()\n[\"1\"] = func()\n[nil] = func()\n", String(keys, Flatten()))
+	warnings = nil
+	String(n, onWarning, StrictGo())
+	equal(t, "Next: cycle, Callback: func elided", strings.Join(warnings, ", "))
+}
+
+func TestSortFields(t *testing.T) {
+	type v1 struct {
+		Name string
+		Age  int
+	}
+	type v2 struct {
+		ID   int
+		Name string
+		Age  int
+	}
+	equal(t, `repr.v1{Age: 30, Name: "Bob"}`, String(v1{Name: "Bob", Age: 30}, SortFields()))
+	equal(t, `repr.v2{Age: 30, ID: 1, Name: "Bob"}`, String(v2{ID: 1, Name: "Bob", Age: 30}, SortFields()))
+}
+
+func TestFieldBudget(t *testing.T) {
+	type request struct {
+		Method  string
+		Body    []byte `json:"body"`
+		Note    string
+		Headers []string
+	}
+	v := request{Method: "POST", Body: []byte("0123456789"), Note: "héllo", Headers: []string{"a", "b", "c"}}
+	equal(t, `repr.request{Method: "POST", Body: []byte("0123") /* 6 more bytes */, Note: "h" /* 5 more bytes */, `+
+		`Headers: []string{"a", "b"} /* 1 more element */}`,
+		String(v, FieldBudget("body", 4), FieldBudget("Note", 2), FieldBudget("Headers", 2), FieldBudget("Method", 4)))
+	var warnings []string
+	String(v, FieldBudget("Body", 4), OnWarning(func(path, reason string) { warnings = append(warnings, path+": "+reason) }))
+	equal(t, "Body: truncated", strings.Join(warnings, ", "))
+}
+
+func TestDecodeFields(t *testing.T) {
+	type message struct {
+		ID      string
+		Payload []byte
+		Note    string
+	}
+	gz := &bytes.Buffer{}
+	zw := gzip.NewWriter(gz)
+	_, _ = zw.Write([]byte(`{"id": 1, "tags": ["a"]}`))
+	_ = zw.Close()
+	v := message{ID: "abcd", Payload: []byte(base64.StdEncoding.EncodeToString(gz.Bytes())), Note: "aGVsbG8="}
+	equal(t, `repr.message{ID: "abcd", Payload: map[string]any{"id": float64(1), "tags": []any{"a"}} `+
+		`/* decoded from base64, gzip, json */, Note: "hello" /* decoded from base64 */}`,
+		String(v, DecodeFields(nil)))
+	onlyNote := func(field reflect.StructField) bool { return field.Name == "Note" }
+	equal(t, `repr.message{ID: "abcd", Payload: []byte("\x1f\x8b") /* 2 more bytes */, Note: "aGVsbG8="}`,
+		String(message{ID: "abcd", Payload: []byte{0x1f, 0x8b, 0, 0}, Note: "aGVsbG8="}, DecodeFields(onlyNote, JSONDecoder), FieldBudget("Payload", 2)))
+	equal(t, `repr.message{ID: "abcd", Note: "aGVsbG8="}`, String(message{ID: "abcd", Note: "aGVsbG8="}, DecodeFields(nil), StrictGo()))
+}
+
+func TestGzipDecoderLimit(t *testing.T) {
+	compress := func(n int) []byte {
+		gz := &bytes.Buffer{}
+		zw := gzip.NewWriter(gz)
+		_, _ = zw.Write(make([]byte, n))
+		_ = zw.Close()
+		return gz.Bytes()
+	}
+	out, ok := GzipDecoder.Decode(compress(MaxGzipSize))
+	equal(t, "true", fmt.Sprint(ok))
+	equal(t, fmt.Sprint(MaxGzipSize), fmt.Sprint(len(out.([]byte))))
+	_, ok = GzipDecoder.Decode(compress(MaxGzipSize + 1))
+	equal(t, "false", fmt.Sprint(ok))
+}
+
+func TestJSONString(t *testing.T) {
+	type item struct {
+		Name    string
+		Tags    []string
+		Attrs   map[string]float64
+		Timeout time.Duration
+		Data    []byte
+		Next    *item
+		private int
+		Func    func()
+	}
+	v := &item{Name: "<a>", Tags: []string{"x"}, Attrs: map[string]float64{"b": 1.5, "a": math.NaN()},
+		Timeout: time.Second, Data: []byte("text"), private: 1}
+	v.Next = v
+	equal(t, `&repr.item{Name: "<a>", Tags: []string{"x"}, Attrs: map[string]float64{"a": NaN, "b": 1.5}, `+
+		`Timeout: time.Duration(1s), Data: []byte("text"), Next: &..., private: 1}`, String(v))
+	equal(t, `{"Name":"<a>","Tags":["x"],"Attrs":{"a":"NaN","b":1.5},"Timeout":"time.Duration(1s)",`+
+		`"Data":"text","Next":null,"private":1}`, JSONString(v))
+	equal(t, `{"Attrs":{"a":"NaN","b":1.5},"Data":"text","Name":"<a>","Next":null,"Tags":["x"],"Timeout":"time.Duration(1s)"}`,
+		JSONString(v, SortFields(), IgnorePrivate()))
+	equal(t, "{\n  \"1\": [\n    true\n  ]\n}", JSONString(map[int][]bool{1: {true}}, Indent("  ")))
+	equal(t, `null`, JSONString(nil))
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	equal(t, `{"T":"time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)","V":"item(2)"}`,
+		JSONString(struct {
+			T time.Time
+			V validGoStringer
+		}{at, validGoStringer{2}}))
+	equal(t, `{"T":"time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)"}`, String(struct{ T time.Time }{at}, Format(JSON)))
+	equal(t, `{"2":3,"nil":4,"a":1}`, JSONString(map[any]int{"a": 1, 2: 3, nil: 4}))
+	equal(t, `[{"key":2,"value":3},{"key":null,"value":4},{"key":"a","value":1}]`,
+		JSONString(map[any]int{"a": 1, 2: 3, nil: 4}, MapEntries()))
+	equal(t, `{"Attrs":[{"key":"a","value":"NaN"},{"key":"b","value":1.5}]}`,
+		JSONString(&item{Attrs: v.Attrs}, MapEntries()))
+	equal(t, `[]`, JSONString(map[string]int{}, MapEntries()))
+}
+
+func TestFormatJSON(t *testing.T) {
+	type user struct {
+		Name     string
+		Password string
+		Tags     []string
+		age      int
+	}
+	v := user{Name: "alice", Password: "hunter2", age: 30}
+	p := New(nil, Format(JSON), NoIndent(), HideField("Password"), IgnorePrivate())
+	equal(t, `{"Name":"alice"}`+"\n", p.Sprintln(v))
+	equal(t, "{\n  \"Name\": \"alice\",\n  \"age\": 30\n}", String(v, Format(JSON), Indent("  "), HideField("Password")))
+	equal(t, `{"Name":"alice","Tags":null}`, JSONString(v, OmitEmpty(false), HideField("Password", "age")))
+}
+
+func TestValue(t *testing.T) {
+	type point struct{ X, Y int }
+	entry := struct {
+		Msg   string `json:"msg"`
+		Value Value  `json:"value"`
+	}{"hello", NewValue(&point{1, 2})}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, `{"msg":"hello","value":"\u0026repr.point{X: 1, Y: 2}"}`, string(data))
+	text, _ := NewValue([]int{1}, Indent("  ")).MarshalText()
+	equal(t, "[]int{\n  1,\n}", string(text))
+	equal(t, `key=map[string]int{"a": 1}`, fmt.Sprintf("key=%s", NewValue(map[string]int{"a": 1})))
+}
+
+func TestStructPlanSharedAcrossOptions(t *testing.T) {
+	type tagged struct {
+		B string `json:"bee"`
+		A int    `json:"-"`
+	}
+	v := tagged{B: "b", A: 1}
+	if planOf(reflect.TypeOf(v)) != planOf(reflect.TypeOf(v)) {
+		t.Fatal("expected plan to be cached")
+	}
+	equal(t, `repr.tagged{B: "b", A: 1}`, String(v))
+	equal(t, `repr.tagged{bee: "b"}`, String(v, UseJSONNames()))
+	equal(t, `repr.tagged{A: 1, B: "b"}`, String(v, SortFields()))
+	equal(t, `repr.tagged{B: "b", A: 1}`, String(v))
+}
+
+func TestInterfaceMapKeys(t *testing.T) {
+	type id string
+	m := map[any]int{1: 1, "1": 2, int8(1): 3, 2.5: 4, true: 5, id("1"): 6, nil: 7}
+	want := `map[any]int{nil: 7, bool(true): 5, float64(2.5): 4, int(1): 1, int8(1): 3, repr.id("1"): 6, "1": 2}`
+	for i := 0; i < 10; i++ {
+		equal(t, want, String(m, LayoutVersion(5)))
+		equal(t, want, String(m, Deterministic(), LayoutVersion(5)))
+	}
+}
+
+func TestNaturalSort(t *testing.T) {
+	m := map[string]int{"item10": 10, "item2": 2, "item1": 1, "item02": 2, "item": 0, "b": 0}
+	equal(t, `map[string]int{"b": 0, "item": 0, "item02": 2, "item1": 1, "item10": 10, "item2": 2}`, String(m))
+	equal(t, `map[string]int{"b": 0, "item": 0, "item1": 1, "item02": 2, "item2": 2, "item10": 10}`, String(m, NaturalSort()))
+	equal(t, `map[string]int{"b": 0, "item": 0, "item1": 1, "item02": 2, "item2": 2, "item10": 10}`, String(m, NaturalSort(), Deterministic()))
+}
+
+func TestKeyCollation(t *testing.T) {
+	m := map[string]int{"b": 1, "B": 2, "a": 3, "é": 4, "Z": 5}
+	equal(t, `map[string]int{"B": 2, "Z": 5, "a": 3, "b": 1, "é": 4}`, String(m))
+	foldAccents := strings.NewReplacer("é", "e")
+	compare := func(a, b string) int {
+		return strings.Compare(foldAccents.Replace(strings.ToLower(a)), foldAccents.Replace(strings.ToLower(b)))
+	}
+	equal(t, `map[string]int{"a": 3, "B": 2, "b": 1, "é": 4, "Z": 5}`, String(m, KeyCollation(compare)))
+}
+
+func TestDumpAll(t *testing.T) {
+	count := 1
+	Register("test.count", func() any { return count })
+	Register("test.config", func() any { return map[string]int{"a": 1} })
+	Register("test.broken", func() any { panic("boom") })
+	Register("test.removed", func() any { return 0 })
+	Register("test.removed", nil)
+	defer func() {
+		for _, name := range []string{"test.count", "test.config", "test.broken"} {
+			Register(name, nil)
+		}
+	}()
+	count = 2
+	w := &strings.Builder{}
+	DumpAll(w)
+	equal(t, `test.broken = <panic: boom>
+test.config = map[string]int{"a": 1}
+test.count = 2
+`, w.String())
+}
+
+func TestDumpOnSignal(t *testing.T) {
+	Register("test.signal", func() any { return "dumped" })
+	defer Register("test.signal", nil)
+	w := &strings.Builder{}
+	signals := make(chan os.Signal)
+	done := dumpOnReceive(signals, w, nil)
+	signals <- os.Interrupt
+	close(signals)
+	<-done
+	equal(t, "test.signal = \"dumped\"\n", w.String())
+	DumpOnSignal(os.Interrupt, w)()
+}
+
+func TestSnapshot(t *testing.T) {
+	type state struct {
+		Counts map[string]int
+		Items  []*int
+	}
+	var lock sync.Mutex
+	s := &state{Counts: map[string]int{}}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			lock.Lock()
+			s.Counts[fmt.Sprint(i%10)] = i
+			n := i
+			s.Items = append(s.Items, &n)
+			lock.Unlock()
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		String(s, Snapshot(&lock))
+	}
+	<-done
+	n := 1
+	v := &state{Counts: map[string]int{"a": 1}, Items: []*int{&n, &n}}
+	equal(t, String(v, Deterministic()), String(v, Deterministic(), Snapshot(nil)))
+}
+
+// Run with -race to check that printing doesn't modify state shared by concurrent calls.
+func TestConcurrentPrinting(t *testing.T) {
+	type node struct {
+		Name     string
+		Children []*node
+	}
+	v := &node{Name: "root", Children: []*node{{Name: "a"}, {Name: "b"}}}
+	v.Children[0].Children = []*node{v}
+	options := []Option{Prefix("> "), MaxWidth(40), Gutter(GutterLineNumbers), UnrollCycles(1), StableAddresses(), ShowAddresses()}
+	w := &strings.Builder{}
+	p := New(w, options...)
+	want := p.Sprintln(v)
+	sequential := &strings.Builder{}
+	seq := New(sequential, options...)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				p.Println(v)
+				equal(t, want, p.Sprintln(v))
+			}
+		}()
+		for j := 0; j < 10; j++ {
+			seq.Println(v)
+		}
+	}
+	wg.Wait()
+	equal(t, sequential.String(), w.String())
+}
+
+func TestSnapshotCycles(t *testing.T) {
+	m := map[string]any{}
+	m["self"] = m
+	equal(t, String(m), String(m, Snapshot(nil)))
+	s := []any{nil}
+	s[0] = s
+	equal(t, "[]any{...}", String(s, Snapshot(nil)))
+}
+
+type lockedState struct {
+	sync.RWMutex
+	Count int
+}
+
+type snapshotState struct {
+	sync.Mutex
+	Count int
+	Self  *snapshotState
+}
+
+func (s *snapshotState) Snapshot() snapshotState {
+	s.Lock()
+	defer s.Unlock()
+	return snapshotState{Count: s.Count * 10, Self: s.Self}
+}
+
+func TestLockStructs(t *testing.T) {
+	s := &lockedState{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			s.Lock()
+			s.Count++
+			s.Unlock()
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		String(s, LockStructs(), OmitEmpty(true))
+	}
+	<-done
+	equal(t, "&repr.lockedState{Count: 1000}", String(s, LockStructs()))
+	equal(t, "[]*repr.lockedState{{Count: 1000}, {Count: 1000}}", String([]*lockedState{s, s}, LockStructs()))
+	equal(t, "&repr.lockedState{\n  Count: 1000,\n}", String(s, LockStructs(), Indent("  "), OmitEmpty(false)))
+	ss := &snapshotState{Count: 1}
+	ss.Self = ss
+	equal(t, "&repr.snapshotState{Count: 10, Self: &...}", String(ss, LockStructs()))
+	equal(t, "&repr.customLock{Count: 1}", String(&customLock{Count: 1}, LockStructs()))
+}
+
+// Has Lock() and Unlock() methods, but no sync.Mutex to hold.
+type customLock struct {
+	Count int
+}
+
+func (c *customLock) Lock()   { panic("Lock() called") }
+func (c *customLock) Unlock() { panic("Unlock() called") }
+
+type lazyValue[T any] struct {
+	once  sync.Once
+	fn    func() T
+	value T
+}
+
+func (l *lazyValue[T]) Load() T {
+	l.once.Do(func() { l.value = l.fn() })
+	return l.value
+}
+
+type future struct{ err error }
+
+func (f future) Get() (string, error) { return "done", f.err }
+
+func TestResolve(t *testing.T) {
+	type config struct {
+		Name   *lazyValue[string]
+		Port   lazyValue[int]
+		Result future
+		Failed future
+	}
+	v := &config{
+		Name:   &lazyValue[string]{fn: func() string { return "server" }},
+		Port:   lazyValue[int]{fn: func() int { return 8080 }},
+		Failed: future{err: errors.New("timeout")},
+	}
+	equal(t, `&repr.config{Name: "server", Port: 8080, Failed: &errors.errorString{s: "timeout"}}`, String(v, Resolve(LazyValue)))
+	equal(t, `repr.future{}`, String(future{}, Resolve(func(v any) (any, bool) { return nil, false })))
+}
+
+type cache[K comparable, V any] struct{ entries map[K]V }
+
+func TestHideGeneric(t *testing.T) {
+	type service struct {
+		Name   string
+		Users  cache[string, int]
+		Groups *cache[int, []string]
+		Ptrs   cache[int, *time.Time]
+	}
+	v := service{Name: "svc", Users: cache[string, int]{entries: map[string]int{"a": 1}}, Ptrs: cache[int, *time.Time]{map[int]*time.Time{}}}
+	equal(t, `repr.service{Name: "svc"}`, String(v, HideGeneric("repr.cache")))
+	equal(t, `repr.service{Name: "svc"}`, String(v, HideGeneric("github.com/alecthomas/repr.cache")))
+	equal(t, `repr.service{Name: "svc", Users: repr.cache[string,int]{entries: map[string]int{"a": 1}}}`, String(v, HideGeneric("other.cache"), Hide[cache[int, *time.Time]]()))
+}
+
+type internalMarker interface{ Internal() }
+
+type internalState struct{ A int }
+
+func (internalState) Internal() {}
+
+func TestHideImplementing(t *testing.T) {
+	type server struct {
+		Name   string
+		Conn   io.Closer
+		File   *os.File
+		State  internalState
+		Buffer *bytes.Buffer
+	}
+	v := server{Name: "srv", Conn: io.NopCloser(nil), File: os.Stdout, State: internalState{1}, Buffer: &bytes.Buffer{}}
+	equal(t, `repr.server{Name: "srv", Buffer: &bytes.Buffer{}}`, String(v, HideImplementing[io.Closer](), HideImplementing[internalMarker]()))
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	HideImplementing[int]()
+}
+
+type dbHandle struct {
+	conns int
+	pool  []int
+}
+
+func TestSummarize(t *testing.T) {
+	type app struct {
+		DB    *dbHandle
+		Stats dbHandle
+	}
+	summary := Summarize(func(db *dbHandle) string { return fmt.Sprintf("open, %d conns */", db.conns) })
+	v := app{DB: &dbHandle{conns: 12, pool: make([]int, 12)}, Stats: dbHandle{conns: 1}}
+	equal(t, "repr.app{DB: *repr.dbHandle /* open, 12 conns * / */, Stats: repr.dbHandle{conns: 1}}", String(v, summary))
+	equal(t, "repr.app{DB: nil /* open, 12 conns * / */, Stats: repr.dbHandle{} /* 1 */}", String(v, summary, StrictGo(),
+		Summarize(func(db dbHandle) string { return fmt.Sprint(db.conns) })))
+}
+
+func TestWalk(t *testing.T) {
+	type node struct {
+		Name     string
+		next     *node
+		Children map[string][]int
+		Skipped  []int
+	}
+	n := &node{Name: "root", Children: map[string][]int{"b": {2}, "a": {1}}, Skipped: []int{1}}
+	n.next = n
+	var visited []string
+	Walk(n, func(path string, v reflect.Value) bool {
+		visited = append(visited, fmt.Sprintf("%s=%v", path, v.Kind()))
+		return path != "Skipped"
+	})
+	equal(t, `<root>=ptr <root>=struct Name=string next=ptr Children=map Children["a"]=slice Children["a"][0]=int `+
+		`Children["b"]=slice Children["b"][0]=int Skipped=slice`, strings.Join(visited, " "))
+	visited = nil
+	Walk(map[any]int{1: 1, "1": 2, nil: 3}, func(path string, v reflect.Value) bool {
+		visited = append(visited, path)
+		return true
+	})
+	equal(t, `<root> ["1"] [int(1)] [nil]`, strings.Join(visited, " "))
+}
+
+func TestKindFormatter(t *testing.T) {
+	type reading struct {
+		Sensor string
+		Value  float64
+		Values []float64
+	}
+	fixed := KindFormatter(reflect.Float64, func(v reflect.Value) string { return strconv.FormatFloat(v.Float(), 'f', 2, 64) })
+	upper := KindFormatter(reflect.String, func(v reflect.Value) string { return strconv.Quote(strings.ToUpper(v.String())) })
+	equal(t, `repr.reading{Sensor: "TEMP", Value: 21.50, Values: []float64{1.00, 2.12}}`,
+		String(reading{Sensor: "temp", Value: 21.5, Values: []float64{1, 2.125}}, fixed, upper))
+}
+
+func TestShallow(t *testing.T) {
+	type inner struct{ A int }
+	type outer struct {
+		Name   string
+		Inner  inner
+		Ptr    *inner
+		Items  []inner
+		Empty  []int
+		Lookup map[string]int
+	}
+	v := &outer{Name: "a", Inner: inner{1}, Ptr: &inner{2}, Items: []inner{{3}}, Empty: []int{}, Lookup: map[string]int{"a": 1}}
+	equal(t, `&repr.outer{Name: "a", Inner: repr.inner{...}, Ptr: &repr.inner{...}, Items: []repr.inner{...}, Lookup: map[string]int{...}}`,
+		String(v, Shallow()))
+	equal(t, `[]int{1, 2}`, String([]int{1, 2}, Shallow()))
+	equal(t, `[]repr.inner{repr.inner{...}}`, String([]inner{{1}}, Shallow()))
+}
+
+func TestMaxDepth(t *testing.T) {
+	type node struct {
+		Value int
+		Next  *node
+	}
+	v := &node{1, &node{2, &node{3, nil}}}
+	var warnings []string
+	onWarning := OnWarning(func(path, reason string) { warnings = append(warnings, path+": "+reason) })
+	equal(t, `&repr.node{Value: 1, Next: &repr.node{Value: 2, Next: &repr.node{/* truncated */}}}`, String(v, MaxDepth(2), onWarning))
+	equal(t, "Next.Next: truncated", strings.Join(warnings, ", "))
+	equal(t, `&repr.node{Value: 1, Next: &repr.node{Value: 2, Next: &repr.node{Value: 3}}}`, String(v, MaxDepth(3)))
+	equal(t, `[][]int{[]int{/* truncated */}, []int{}}`, String([][]int{{1}, {}}, MaxDepth(1), OmitEmpty(false)))
+}
+
+type methodSet struct{ A int }
+
+func (methodSet) Read(p []byte) (int, error) { return 0, nil }
+func (*methodSet) Close() error              { return nil }
+func (methodSet) unexported()                {}
+
+func TestShowMethods(t *testing.T) {
+	equal(t, `&repr.methodSet{A: 1} /* methods: Close, Read */`, String(&methodSet{A: 1}, ShowMethods()))
+	equal(t, `repr.methodSet{A: 1} /* methods: Read */`, String(methodSet{A: 1}, ShowMethods()))
+	equal(t, `1`, String(1, ShowMethods()))
+}
+
+func TestSizeComments(t *testing.T) {
+	type entry struct {
+		Key  string
+		Data []byte
+	}
+	type cache struct {
+		Small []int32
+		Large []entry
+	}
+	v := &cache{Small: []int32{1, 2}, Large: []entry{{Key: "abcd", Data: []byte("ab")}}}
+	equal(t, `&repr.cache{Small: []int32{1, 2} /* ~32B */, Large: []repr.entry{{Key: "abcd", Data: []byte("ab")} /* ~46B */} /* ~70B */} /* ~102B */`,
+		String(v, SizeComments()))
+	v.Large[0].Data = make([]byte, 20000)
+	have := String(v, SizeComments())
+	equal(t, `")} /* ~19KB */} /* ~19KB */} /* ~19KB */`, have[len(have)-41:])
+	equal(t, "1", String(1, SizeComments()))
+}
+
+func TestShowLayout(t *testing.T) {
+	if unsafe.Sizeof(uintptr(0)) != 8 {
+		t.Skip("layout differs on 32-bit platforms")
+	}
+	type padded struct {
+		A bool
+		B int64
+		C int32
+	}
+	equal(t, "repr.padded{\n"+
+		"  A: true /* off=0 size=1 align=1 pad=7 */,\n"+
+		"  B: 2 /* off=8 size=8 align=8 */,\n"+
+		"  C: 3 /* off=16 size=4 align=4 pad=4 */,\n"+
+		"}", String(padded{A: true, B: 2, C: 3}, ShowLayout(), Indent("  ")))
+}
+
+func TestGoVarsConsts(t *testing.T) {
+	source, err := GoVars("fixtures", []Var{
+		{Name: "Name", Value: "server"},
+		{Name: "Timeout", Value: time.Second},
+		{Name: "Ports", Value: []int{80}},
+		{Name: "Missing", Value: math.NaN()},
+		{Name: "Level", Value: Enum(1)},
+		{Name: "Small", Value: int8(5)},
+		{Name: "Count", Value: uint(3)},
+		{Name: "Ratio", Value: 2.0},
+	}, Consts(), NoIndent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, `package fixtures
+
+import (
+	"github.com/alecthomas/repr"
+	"math"
+	"time"
+)
+
+const (
+	Name            = "server"
+	Timeout         = time.Duration(1000000000)
+	Level           = repr.Enum(1)
+	Small   int8    = 5
+	Count   uint    = 0x3
+	Ratio   float64 = 2
+)
+
+var (
+	Ports   = []int{80}
+	Missing = float64(math.NaN())
+)
+`, string(source))
+}
+
+func TestGoVarsInternStrings(t *testing.T) {
+	type link struct {
+		URL   string
+		Label Enum
+		Name  string
+	}
+	url := "https://example.com/a/long/path"
+	source, err := GoVars("fixtures", []Var{
+		{Name: "links", Value: []link{{URL: url, Name: "a"}, {URL: url, Name: "a"}}},
+		{Name: "names", Value: map[string]string{url: "b"}},
+	}, InternStrings(10), NoIndent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, `package fixtures
+
+var (
+	links = nil /* 2 elements, type repr.link unexported */
+	names = map[string]string{"https://example.com/a/long/path": "b"}
+)
+`, string(source))
+}
+
+func TestGoVarsDedupSubtrees(t *testing.T) {
+	type address struct {
+		Street string
+		City   string
+	}
+	type person struct {
+		Name    string
+		Home    address
+		Work    *address
+		Aliases []string
+	}
+	home := address{Street: "1 Main St", City: "Springfield"}
+	source, err := GoVars("fixtures", []Var{
+		{Name: "people", Value: []person{
+			{Name: "a", Home: home, Work: &address{Street: "2 Side St", City: "Springfield"}},
+			{Name: "b", Home: home, Aliases: []string{"bee", "bea"}},
+		}},
+		{Name: "aliases", Value: []string{"bee", "bea"}},
+	}, DedupSubtrees(20), NoIndent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, `package fixtures
+
+var (
+	people  = nil /* 2 elements, type repr.person unexported */
+	aliases = []string{"bee", "bea"}
+)
+`, string(source))
+}
+
+func TestDiffFriendly(t *testing.T) {
+	type record struct {
+		Zeta   []int
+		Alpha  map[string]int
+		hidden int
+	}
+	v := record{Zeta: []int{1, 2}, Alpha: map[string]int{"b": 2, "a": 1}, hidden: 1}
+	equal(t, `repr.record{
+  Alpha: map[string]int{
+    "a": 1,
+    "b": 2,
+  },
+  Zeta: []int{
+    1,
+    2,
+  },
+}`, String(v, NoIndent(), DiffFriendly(), IgnorePrivate()))
+	equal(t, "repr.record{\n\tAlpha: map[string]int{\n\t\t\"a\": 1,\n\t},\n}", String(record{Alpha: map[string]int{"a": 1}}, Indent("\t"), DiffFriendly()))
+}
+
+func TestLayoutVersion(t *testing.T) {
+	type private struct {
+		A int
+		b int
+	}
+	v := private{A: 1, b: 2}
+	equal(t, "repr.private{\n  A: 1}", String(v, Indent("  "), IgnorePrivate()))
+	equal(t, "repr.private{\n  A: 1}", String(v, Indent("  "), IgnorePrivate(), LayoutVersion(1)))
+	equal(t, "repr.private{\n  A: 1,\n}", String(v, Indent("  "), IgnorePrivate(), LayoutVersion(LatestLayout)))
+}
+
+func TestMaxWidth(t *testing.T) {
+	type point struct{ X, Y int }
+	type shape struct {
+		Name   string
+		Points []point
+		Tags   map[string]string
+	}
+	v := shape{Name: "triangle", Points: []point{{1, 2}, {3, 4}, {5, 6}}, Tags: map[string]string{"colour": "red"}}
+	equal(t, `repr.shape{Name: "triangle", Points: []repr.point{{X: 1, Y: 2}, {X: 3, Y: 4}, {X: 5, Y: 6}}, Tags: map[string]string{"colour": "red"}}`,
+		String(v, Indent("  "), MaxWidth(140)))
+	equal(t, `repr.shape{
+  Name: "triangle",
+  Points: []repr.point{{X: 1, Y: 2}, {X: 3, Y: 4}, {X: 5, Y: 6}},
+  Tags: map[string]string{"colour": "red"},
+}`, String(v, Indent("  "), MaxWidth(70)))
+	equal(t, `repr.shape{
+  Name: "triangle",
+  Points: []repr.point{
+    {X: 1, Y: 2},
+    {X: 3, Y: 4},
+    {X: 5, Y: 6},
+  },
+  Tags: map[string]string{"colour": "red"},
+}`, String(v, Indent("  "), MaxWidth(50)))
+
+	// Values that don't fit are abandoned part way through, which must not affect cycle detection.
+	type node struct {
+		Name string
+		Next *node
+	}
+	n := &node{Name: "a very long name that does not fit"}
+	n.Next = n
+	equal(t, `&repr.node{
+  Name: "a very long name that does not fit",
+  Next: &...,
+}`, String(n, Indent("  "), MaxWidth(30)))
+}
+
+func TestIndentFunc(t *testing.T) {
+	type inner struct{ A []int }
+	type outer struct{ Inner inner }
+	markers := IndentFunc(func(level int) string { return strconv.Itoa(level) + "  " })
+	equal(t, `repr.outer{
+1  Inner: repr.inner{
+1  2  A: []int{
+1  2  3  1,
+1  2  },
+1  },
+}`, String(outer{Inner: inner{A: []int{1}}}, markers))
+	equal(t, `repr.outer{Inner: repr.inner{A: []int{1}}}`, String(outer{Inner: inner{A: []int{1}}}, markers, NoIndent()))
+}
+
+func TestGroupKeys(t *testing.T) {
+	config := map[string]string{
+		"db.host":       "localhost",
+		"db.pool.max":   "10",
+		"db.pool.min":   "1",
+		"log.level":     "debug",
+		"name":          "app",
+		"server.listen": ":80",
+	}
+	equal(t, `map[string]string{
+  "db.": {
+    "host": "localhost",
+    "pool.": {
+      "max": "10",
+      "min": "1",
+    },
+  },
+  "log.level": "debug",
+  "name": "app",
+  "server.listen": ":80",
+}`, String(config, Indent("  "), GroupKeys(".")))
+	equal(t, `map[string]string{"db.": {"host": "localhost", "pool.": {"max": "10", "min": "1"}}, "log.level": "debug", "name": "app", "server.listen": ":80"}`,
+		String(config, GroupKeys(".")))
+}
+
+func TestSprint(t *testing.T) {
+	type point struct{ X, Y int }
+	equal(t, "repr.point{\n  X: 1,\n  Y: 2,\n} \"a\"", Sprint(point{1, 2}, "a"))
+	equal(t, "repr.point{X: 1, Y: 2}\n", Sprintln(point{1, 2}, NoIndent()))
+	equal(t, `point=repr.point{X: 1, Y: 2} n=  42 s="a" t=int`, Sprintf("point=%r n=%4d s=%q t=%T", point{1, 2}, 42, "a", 1))
+	equal(t, `[]int{1} 1 []int{1} 2`, Sprintf("%[2]r %[1]d %r %*d", 1, []int{1}, 1, 2))
+	equal(t, "[]int{\n  1,\n}", Sprintf("%r", []int{1}, Indent("  ")))
+	p := New(nil, Indent("  "), Prefix("> "))
+	equal(t, "value: repr.point{\n>   X: 1,\n>   Y: 2,\n> }", p.Sprintf("value: %r", point{1, 2}))
+}
+
+// Records each write made to it.
+type writeRecorder struct{ writes []string }
+
+func (w *writeRecorder) Write(b []byte) (int, error) {
+	w.writes = append(w.writes, string(b))
+	return len(b), nil
+}
+
+func TestBufferedOutput(t *testing.T) {
+	v := map[string][]int{"a": {1, 2, 3}, "b": {4, 5, 6}}
+	for _, options := range [][]Option{nil, {MaxWidth(20)}, {Prefix("> ")}} {
+		w := &writeRecorder{}
+		p := New(w, options...)
+		p.Print(v)
+		if len(w.writes) != 1 {
+			t.Errorf("expected a single write but got %q", w.writes)
+		}
+		equal(t, p.Sprint(v), strings.Join(w.writes, ""))
+	}
+}
+
+// A map key that deletes entries from its map when printed.
+type DeletingKey string
+
+var deletingMap map[DeletingKey]int
+
+func (k DeletingKey) GoString() string {
+	for other := range deletingMap {
+		if other != k {
+			delete(deletingMap, other)
+		}
+	}
+	return strconv.Quote(string(k))
+}
+
+func TestDeletedMapEntries(t *testing.T) {
+	reset := func() map[DeletingKey]int {
+		deletingMap = map[DeletingKey]int{"a": 1, "b": 2}
+		return deletingMap
+	}
+	equal(t, `map[repr.DeletingKey]int{"a": 1, "b": /* invalid */}`, String(reset()))
+	equal(t, `map[repr.DeletingKey]int{"a": 1, "b": nil /* invalid */}`, String(reset(), StrictGo()))
+	equal(t, "[\"a\"] = 1\n[\"b\"] = /* invalid */\n", String(reset(), Flatten()))
+	var warnings []string
+	String(reset(), OnWarning(func(path, reason string) { warnings = append(warnings, path+": "+reason) }))
+	equal(t, `["b"]: invalid value`, strings.Join(warnings, ", "))
+}
+
+type flushRecorder struct {
+	strings.Builder
+	flushed []string
+}
+
+func (f *flushRecorder) Flush() { f.flushed = append(f.flushed, f.String()) }
+
+func TestAutoFlush(t *testing.T) {
+	w := &bytes.Buffer{}
+	b := bufio.NewWriter(w)
+	New(b, AutoFlush()).Print(1, 2)
+	equal(t, "1 2", w.String())
+	f := &flushRecorder{}
+	New(f, AutoFlush()).Println(1, 2)
+	equal(t, "1|1 2|1 2\n", strings.Join(f.flushed, "|"))
+	f = &flushRecorder{}
+	New(f).Println(1)
+	equal(t, "", strings.Join(f.flushed, "|"))
+}
+
+func TestQuote(t *testing.T) {
+	type point struct{ Name string }
+	equal(t, `"repr.point{Name: \"a\\tb\"}"`, Quote(point{"a\tb"}))
+	equal(t, `"repr.point{\n  Name: \"a\",\n}"`, Quote(point{"a"}, Indent("  ")))
+}
+
+func TestMarkdown(t *testing.T) {
+	type point struct{ Name string }
+	equal(t, "**Request**\n\n```go\nrepr.point{\n  Name: \"a\",\n}\n```\n", Markdown(point{"a"}, Caption("**Request**")))
+	equal(t, "````go\nrepr.point{Name: \"```\"}\n````\n", Markdown(point{"```"}, NoIndent()))
+}
+
+func TestColor(t *testing.T) {
+	type point struct {
+		Name string
+		X    int
+	}
+	equal(t, "\x1b[36mrepr.point\x1b[0m{\x1b[34mName\x1b[0m: \x1b[32m\"a\"\x1b[0m, \x1b[34mX\x1b[0m: \x1b[35m1\x1b[0m}",
+		String(point{"a", 1}, ForceColor()))
+	equal(t, `repr.point{Name: "a", X: 1}`, String(point{"a", 1}, ForceColor(), NoColor()))
+	equal(t, `repr.point{Name: "a", X: 1}`, String(point{"a", 1}, AutoColor()))
+	// Widths exclude escape codes.
+	equal(t, "10", strconv.Itoa(visibleWidth("\x1b[36mrepr.point\x1b[0m")))
+	type outer struct{ Inner point }
+	have := String(outer{point{"a", 1}}, ForceColor(), Indent("  "), MaxWidth(40))
+	equal(t, "repr.outer{\n  Inner: repr.point{Name: \"a\", X: 1},\n}", stripANSI(have))
+}
+
+func stripANSI(s string) string {
+	for {
+		start := strings.Index(s, "\x1b[")
+		if start < 0 {
+			return s
+		}
+		end := strings.IndexByte(s[start:], 'm')
+		s = s[:start] + s[start+end+1:]
+	}
+}
+
+func TestHTML(t *testing.T) {
+	type point struct {
+		Name string
+		Tags []string
+	}
+	equal(t, `<pre class="repr"><span class="repr-type">repr.point</span>{<span class="repr-field">Name</span>: <span class="repr-string">&#34;&lt;b&gt;&#34;</span>}</pre>`,
+		HTML(point{Name: "<b>"}, NoIndent()))
+	equal(t, `<pre class="repr"><details open><summary><span class="repr-type">repr.point</span>{</summary>
+  <span class="repr-field">Tags</span>: <details open><summary><span class="repr-type">[]string</span>{</summary>
+    <span class="repr-string">&#34;a&#34;</span>,
+  </details>},
+</details>}</pre>`, HTML(point{Tags: []string{"a"}}))
+	equal(t, `<pre class="repr"><span class="num">1</span></pre>`, HTML(1, Colors(Theme{Number: "num"})))
+	equal(t, "7", strconv.Itoa(htmlWidth(`<span class="x">&lt;hello</span>&gt;`)))
+}
+
+type hostileGoString string
+
+func (h hostileGoString) GoString() string { return string(h) }
+
+func TestHTMLEscapesHostileText(t *testing.T) {
+	type page struct {
+		Body  hostileGoString
+		Title string
+	}
+	v := page{Body: "x\x00<script>alert(1)</script>\x00", Title: "\x00</span><script>\x00"}
+	equal(t, "<pre class=\"repr\"><span class=\"repr-type\">repr.page</span>{<span class=\"repr-field\">Body</span>: x\x00&lt;script&gt;alert(1)&lt;/script&gt;\x00, "+
+		`<span class="repr-field">Title</span>: <span class="repr-string">&#34;\x00&lt;/span&gt;&lt;script&gt;\x00&#34;</span>}</pre>`,
+		HTML(v, NoIndent()))
+	equal(t, "<pre class=\"repr\">Body = x\x00&lt;script&gt;alert(1)&lt;/script&gt;\x00\nTitle = <span class=\"repr-string\">&#34;\\x00&lt;/span&gt;&lt;script&gt;\\x00&#34;</span>\n</pre>",
+		HTML(v, Flatten()))
+	equal(t, "<pre class=\"repr\">&lt;root&gt;  | <details open><summary>map[string]int{</summary>\n[&#34;&lt;b&gt;&#34;] |   &#34;&lt;b&gt;&#34;: 1,\n&lt;root&gt;  | </details>}</pre>",
+		HTML(map[string]int{"<b>": 1}, Gutter(GutterPaths), Colors(Theme{})))
+}
+
+func TestTheme(t *testing.T) {
+	type point struct{ Name string }
+	theme := Theme{Type: "1;33", String: "31"}
+	equal(t, "\x1b[1;33mrepr.point\x1b[0m{Name: \x1b[31m\"a\"\x1b[0m}", String(point{"a"}, ForceColor(), Colors(theme)))
+	equal(t, `repr.point{Name: "a"}`, String(point{"a"}, Colors(theme)))
+}
+
+func TestFlatten(t *testing.T) {
+	type container struct {
+		Image string
+		Ports []int
+		Env   map[string]string
+	}
+	type spec struct {
+		Containers []container
+		Created    time.Time
+		Labels     map[string]string
+		Empty      []int
+	}
+	v := &spec{
+		Containers: []container{{Image: "nginx:1.25", Ports: []int{80, 443}, Env: map[string]string{"B": "2", "A": "1"}}},
+		Created:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Labels:     map[string]string{},
+	}
+	equal(t, `Containers[0].Image = "nginx:1.25"
+Containers[0].Ports[0] = 80
+Containers[0].Ports[1] = 443
+Containers[0].Env["A"] = "1"
+Containers[0].Env["B"] = "2"
+Created = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+`, String(v, Flatten()))
+	equal(t, "<root> = 1\n", String(1, Flatten()))
+	labels := map[string]string{"app": "web", "k8s.io/name": "x", "type": "y"}
+	equal(t, "[app] = \"web\"\n[\"k8s.io/name\"] = \"x\"\n[\"type\"] = \"y\"\n", String(labels, Flatten(), BareKeys()))
+	equal(t, `map[string]string{"app": "web", "k8s.io/name": "x", "type": "y"}`, String(labels, BareKeys()))
+	equal(t, "Labels = map[string]string{}\n", String(spec{Labels: map[string]string{}}, Flatten(), OmitEmpty(false), HideField("Containers", "Created", "Empty")))
+}
+
+func TestDiff(t *testing.T) {
+	type spec struct {
+		Name     string
+		Image    string
+		Replicas int
+		Ports    []int
+		Labels   map[string]string
+		Owner    string
+	}
+	want := spec{Name: "web", Image: "nginx", Replicas: 2, Ports: []int{80}, Labels: map[string]string{"a": "1", "b": "2"}, Owner: "ops"}
+	got := spec{Name: "web", Image: "nginx", Replicas: 3, Ports: []int{80, 443}, Labels: map[string]string{"b": "2"}, Owner: "ops"}
+	equal(t, `  Image = "nginx"
+- Replicas = 2
++ Replicas = 3
+  Ports[0] = 80
++ Ports[1] = 443
+- Labels["a"] = "1"
+  Labels["b"] = "2"
+`, Diff(want, got))
+	equal(t, "", Diff(want, want))
+	equal(t, "- <root> = 1\n+ <root> = 2\n", Diff(1, 2))
+	equal(t, "\x1b[31m- <root> = 1\x1b[0m\n\x1b[32m+ <root> = 2\x1b[0m\n", Diff(1, 2, ForceColor()))
+	equal(t, "- <type> = int\n+ <type> = int64\n  <root> = 1\n", Diff(1, int64(1)))
+	equal(t, "- <type> = []int\n+ <type> = []int64\n  [0] = 1\n", Diff([]int{1}, []int64{1}))
+	equal(t, "- <type> = nil\n+ <type> = *int\n  <root> = nil\n", Diff(nil, (*int)(nil)))
+	equal(t, "- [0] = int(1)\n+ [0] = int64(1)\n", Diff([]any{1}, []any{int64(1)}))
+	equal(t, "  [0] = 1\n- [1] = 2\n+ [1] = 3\n  [2] = 3\n@@\n  [4] = 5\n- [5] = 6\n+ [5] = 7\n",
+		Diff([]int{1, 2, 3, 4, 5, 6}, []int{1, 3, 3, 4, 5, 7}))
+	options := make([]Option, 1, 2)
+	options[0] = NoIndent()
+	spare := options[:2]
+	spare[1] = ForceColor()
+	Diff(1, 2, options...)
+	// Diff must not have overwritten the caller's spare capacity with its own options.
+	equal(t, "\x1b[31m- <root> = 1\x1b[0m\n\x1b[32m+ <root> = 2\x1b[0m\n", Diff(1, 2, spare[1:]...))
+}
+
+func TestGutter(t *testing.T) {
+	type port struct {
+		N    int
+		Tags []string
+	}
+	type spec struct {
+		Ports []port
+		M     map[string]int
+	}
+	v := spec{Ports: []port{{80, []string{"a"}}, {N: 443}}, M: map[string]int{"x": 1}}
+	equal(t, `<root>           | repr.spec{
+Ports            |   Ports: []repr.port{
+Ports[0]         |     {
+Ports[0].N       |       N: 80,
+Ports[0].Tags    |       Tags: []string{
+Ports[0].Tags[0] |         "a",
+Ports[0].Tags    |       },
+Ports[0]         |     },
+Ports[1]         |     {
+Ports[1].N       |       N: 443,
+Ports[1]         |     },
+Ports            |   },
+M                |   M: map[string]int{
+M["x"]           |     "x": 1,
+M                |   },
+<root>           | }`, String(v, Indent("  "), Gutter(GutterPaths)))
+	lines := New(nil, Gutter(GutterLineNumbers)).Sprintln(v.Ports)
+	equal(t, ` 1 | []repr.port{
+ 2 |   {
+ 3 |     N: 80,
+ 4 |     Tags: []string{
+ 5 |       "a",
+ 6 |     },
+ 7 |   },
+ 8 |   {
+ 9 |     N: 443,
+10 |   },
+11 | }
+`, lines)
+	equal(t, `1 | []int{1, 2}`, String([]int{1, 2}, Gutter(GutterLineNumbers)))
+}
+
+func TestFind(t *testing.T) {
+	type result struct {
+		Status  string
+		Details []string
+		Nested  map[string]any
+	}
+	v := result{Status: "error: timeout", Details: []string{"ok", "error: retry"}, Nested: map[string]any{"code": 504, "msg": "error: upstream"}}
+	matches := Find(v, func(path string, v reflect.Value) bool {
+		return v.Kind() == reflect.String && strings.Contains(v.String(), "error")
+	})
+	found := []string{}
+	for _, m := range matches {
+		found = append(found, m.Path+" = "+m.Repr)
+	}
+	equal(t, `Status = "error: timeout"
+Details[1] = "error: retry"
+Nested["msg"] = "error: upstream"`, strings.Join(found, "\n"))
+}
+
+// A pair of values.
+type sourcePair struct {
+	Left, Right *sourceLeaf // Children.
+}
+
+type sourceLeaf struct{ Value time.Duration }
+
+func TestTypeSource(t *testing.T) {
+	v := sourcePair{Left: &sourceLeaf{Value: time.Second}}
+	equal(t, `repr.sourcePair{Left: &repr.sourceLeaf{Value: time.Duration(1s)}}
+// type sourcePair struct {
+// 	Left, Right *sourceLeaf // Children.
+// }
+
+// type sourceLeaf struct{ Value time.Duration }
+`, String(v, TypeSource()))
+}
+
+// Baseline allocations, which changes to the printer should not increase without good reason:
+//
+//	BenchmarkFlatSlice          30003 allocs/op
+//	BenchmarkStructs            42914 allocs/op
+//	BenchmarkString                59 allocs/op
+//	BenchmarkDeepStruct         29697 allocs/op
+//	BenchmarkBigMap            110207 allocs/op
+//	BenchmarkStrings             4015 allocs/op
+//	BenchmarkUnexportedFields   33889 allocs/op
+//	BenchmarkUnbufferedWriter   40015 allocs/op, 13 writes/op
+//	BenchmarkMaxWidth           74812 allocs/op
+func BenchmarkFlatSlice(b *testing.B) {
+	v := make([]int, 10000)
+	for i := range v {
+		v[i] = i
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		New(io.Discard, NoIndent()).Print(v)
+	}
+}
+
+func BenchmarkStructs(b *testing.B) {
+	type item struct {
+		Name  string
+		Count int
+		Tags  []string
+		Attrs map[string]int
+	}
+	v := make([]item, 1000)
+	for i := range v {
+		v[i] = item{Name: "item", Count: i, Tags: []string{"a", "b"}, Attrs: map[string]int{"x": 1}}
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		New(io.Discard).Print(v)
+	}
+}
+
+func BenchmarkString(b *testing.B) {
+	v := map[string][]int{"a": {1, 2, 3}, "b": {4, 5, 6}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = String(v)
+	}
+}
+
+func BenchmarkDeepStruct(b *testing.B) {
+	type node struct {
+		Name     string
+		Value    float64
+		Children []*node
+	}
+	var build func(depth int) *node
+	build = func(depth int) *node {
+		n := &node{Name: "node", Value: float64(depth)}
+		if depth > 0 {
+			n.Children = []*node{build(depth - 1), build(depth - 1)}
+		}
+		return n
+	}
+	v := build(10)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		New(io.Discard).Print(v)
+	}
+}
+
+func BenchmarkBigMap(b *testing.B) {
+	v := make(map[string]int, 10000)
+	for i := 0; i < 10000; i++ {
+		v["key"+strconv.Itoa(i)] = i
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		New(io.Discard).Print(v)
+	}
+}
+
+func BenchmarkStrings(b *testing.B) {
+	v := make([]string, 1000)
+	for i := range v {
+		v[i] = strings.Repeat("a \"quoted\"\tstring\n", 10)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		New(io.Discard).Print(v)
+	}
+}
+
+func BenchmarkUnexportedFields(b *testing.B) {
+	type inner struct {
+		name  string
+		count int
+	}
+	type outer struct {
+		id    int
+		inner inner
+		tags  []string
+	}
+	v := make([]outer, 1000)
+	for i := range v {
+		v[i] = outer{id: i, inner: inner{name: "inner", count: i}, tags: []string{"a"}}
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		New(io.Discard).Print(v)
+	}
+}
+
+// Counts the writes made to it, standing in for an unbuffered file or socket.
+type writeCounter struct{ writes int }
+
+func (w *writeCounter) Write(b []byte) (int, error) {
+	w.writes++
+	return len(b), nil
+}
+
+func BenchmarkUnbufferedWriter(b *testing.B) {
+	v := make([]int, 10000)
+	w := &writeCounter{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		New(w).Print(v)
+	}
+	b.ReportMetric(float64(w.writes)/float64(b.N), "writes/op")
+}
+
+func BenchmarkMaxWidth(b *testing.B) {
+	type node struct {
+		Name     string
+		Children []*node
+	}
+	var build func(depth int) *node
+	build = func(depth int) *node {
+		n := &node{Name: "node"}
+		if depth > 0 {
+			n.Children = []*node{build(depth - 1), build(depth - 1)}
+		}
+		return n
+	}
+	v := build(10)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		New(io.Discard, MaxWidth(80)).Print(v)
+	}
+}
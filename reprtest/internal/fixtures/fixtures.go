@@ -0,0 +1,26 @@
+// Package fixtures declares the types used to test reprtest, outside test files so that RoundTrip
+// can load them to type-check its output.
+package fixtures
+
+import (
+	"strconv"
+	"time"
+)
+
+type Config struct {
+	Name    string
+	Timeout time.Duration
+	Limits  map[string]int64
+	Values  []any
+	Created time.Time
+}
+
+// Celsius is represented as an untyped constant, so a rebuilt value is a float64.
+type Celsius float64
+
+func (c Celsius) GoString() string { return strconv.FormatFloat(float64(c), 'g', -1, 64) }
+
+// Unqualified is represented without its package qualifier, so doesn't compile in other packages.
+type Unqualified int
+
+func (u Unqualified) GoString() string { return "Unqualified(" + strconv.Itoa(int(u)) + ")" }
@@ -0,0 +1,95 @@
+// Package reprtest contains helpers for testing that repr output can be used as Go source.
+package reprtest
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/repr"
+)
+
+// RoundTrip renders v in StrictGo mode and reports any constructs in the output that would not
+// rebuild the same value.
+//
+// The output must parse as a Go expression, must not contain any comments (which StrictGo mode uses
+// to describe values it could not represent), must not take the address of non-composite values, and
+// must not contain function values. The Go file that repr.GoFile generates for v is then type-checked
+// with go/types, loading the packages it imports from source, and the variable it declares must have
+// the type of v. The type check is skipped if the file refers to identifiers that can't be loaded
+// from other packages, such as unexported types or types declared in test files or functions.
+func RoundTrip(t testing.TB, v any, options ...repr.Option) {
+	t.Helper()
+	source := repr.String(v, append([]repr.Option{repr.StrictGo()}, options...)...)
+	problems := Check(source)
+	for _, problem := range problems {
+		t.Errorf("%s in %s", problem, source)
+	}
+	if len(problems) > 0 {
+		return
+	}
+	if problem, ok := typeCheck(v, options...); ok && problem != "" {
+		t.Errorf("%s in %s", problem, source)
+	}
+}
+
+// Check returns a description of each construct in source that would not rebuild the value it
+// represents.
+func Check(source string) []string {
+	expr, err := parser.ParseExpr(source)
+	if err != nil {
+		return []string{"invalid Go expression: " + err.Error()}
+	}
+	problems := []string{}
+	fset := token.NewFileSet()
+	var s scanner.Scanner
+	s.Init(fset.AddFile("", fset.Base(), len(source)), []byte(source), nil, scanner.ScanComments)
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.COMMENT {
+			problems = append(problems, "unrepresentable value "+strings.TrimSpace(strings.Trim(lit, "/*")))
+		}
+	}
+	return append(problems, checkExpr(expr)...)
+}
+
+func checkExpr(expr ast.Expr) []string {
+	switch expr := expr.(type) {
+	case *ast.CompositeLit:
+		problems := []string{}
+		for _, elt := range expr.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				problems = append(problems, checkExpr(kv.Key)...)
+				elt = kv.Value
+			}
+			problems = append(problems, checkExpr(elt)...)
+		}
+		return problems
+
+	case *ast.UnaryExpr:
+		if _, ok := expr.X.(*ast.CompositeLit); expr.Op == token.AND && !ok {
+			return append([]string{"address of non-composite value"}, checkExpr(expr.X)...)
+		}
+		return checkExpr(expr.X)
+
+	case *ast.ParenExpr:
+		return checkExpr(expr.X)
+
+	case *ast.CallExpr:
+		problems := []string{}
+		for _, arg := range expr.Args {
+			problems = append(problems, checkExpr(arg)...)
+		}
+		return problems
+
+	case *ast.FuncType:
+		return []string{"function value"}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package reprtest
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/repr"
+	"github.com/alecthomas/repr/reprtest/internal/fixtures"
+)
+
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+type node struct {
+	Next *node
+	Name string
+}
+
+type config struct {
+	Name    string
+	Timeout *time.Duration
+	Count   *int
+	Ratio   float64
+	Tags    []string
+	Created time.Time
+}
+
+func TestRoundTrip(t *testing.T) {
+	timeout := time.Second
+	count := 3
+	RoundTrip(t, &config{
+		Name:    "test",
+		Timeout: &timeout,
+		Count:   &count,
+		Ratio:   math.Inf(-1),
+		Tags:    []string{"a", "b"},
+		Created: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+	})
+	RoundTrip(t, []*int{&count, nil})
+	RoundTrip(t, &fixtures.Config{
+		Name:    "test",
+		Timeout: time.Second,
+		Limits:  map[string]int64{"a": 1},
+		Values:  []any{int8(1), "b", fixtures.Celsius(2)},
+		Created: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+	})
+	RoundTrip(t, int64(7))
+	RoundTrip(t, 2.0)
+}
+
+func TestRoundTripFailures(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{"Cycle", func() any { n := &node{Name: "a"}; n.Next = n; return n }(), "unrepresentable value cycle"},
+		{"Func", func() {}, "unrepresentable value func elided"},
+		{"LostType", fixtures.Celsius(21.5), "rebuilt value has type float64, not fixtures.Celsius"},
+		{"TypeError", fixtures.Unqualified(1), "type error: roundtrip.go:3:9: undefined: Unqualified"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &recorder{}
+			RoundTrip(r, test.value)
+			if len(r.errors) != 1 || !strings.HasPrefix(r.errors[0], test.want) {
+				t.Errorf("expected a single %q error but got %q", test.want, r.errors)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	if problems := Check("&13"); len(problems) != 1 || problems[0] != "address of non-composite value" {
+		t.Errorf("unexpected problems %q", problems)
+	}
+	if problems := Check("&repr.T{A: ...}"); len(problems) != 1 || !strings.HasPrefix(problems[0], "invalid Go expression") {
+		t.Errorf("unexpected problems %q", problems)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	if r := (&recorder{}); !Equal(r, []byte("a"), []byte("a")) || len(r.errors) != 0 {
+		t.Errorf("unexpected errors %q", r.errors)
+	}
+	r := &recorder{}
+	if Equal(r, &node{Name: "a"}, &node{Name: "b"}, "node %d", 1) {
+		t.Fatal("expected values to differ")
+	}
+	want := `Not equal:
+expected: &reprtest.node{
+            Name: "a",
+          }
+actual  : &reprtest.node{
+            Name: "b",
+          }
+Messages: node 1`
+	if len(r.errors) != 1 || r.errors[0] != want {
+		t.Errorf("\nWant: %q\nHave: %q", want, r.errors)
+	}
+}
+
+func TestEqualFuncTable(t *testing.T) {
+	var assertion func(TestingT, any, any, ...any) bool = EqualFunc(repr.NoIndent())
+	r := &recorder{}
+	assertion(r, 1, 2)
+	if want := "Not equal:\nexpected: 1\nactual  : 2"; len(r.errors) != 1 || r.errors[0] != want {
+		t.Errorf("\nWant: %q\nHave: %q", want, r.errors)
+	}
+}
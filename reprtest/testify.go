@@ -0,0 +1,90 @@
+package reprtest
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/alecthomas/repr"
+)
+
+// TestingT is the subset of testing.TB used by the testify-compatible assertions. It has the same
+// method set as testify's assert.TestingT, so any assert.TestingT is a TestingT.
+type TestingT interface {
+	Errorf(format string, args ...any)
+}
+
+// Equal asserts that expected and actual are equal, rendering both with repr on failure.
+//
+// It has the same parameters and equality semantics as testify's assert.Equal, but takes a TestingT
+// rather than an assert.TestingT, so it is not an assert.ComparisonAssertionFunc. To use it as one,
+// eg. in table driven tests, wrap it:
+//
+//	func(t assert.TestingT, expected, actual any, msgAndArgs ...any) bool {
+//		return reprtest.Equal(t, expected, actual, msgAndArgs...)
+//	}
+func Equal(t TestingT, expected, actual any, msgAndArgs ...any) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	return EqualFunc()(t, expected, actual, msgAndArgs...)
+}
+
+// EqualFunc returns an assertion like Equal that renders values with the given repr options.
+func EqualFunc(options ...repr.Option) func(t TestingT, expected, actual any, msgAndArgs ...any) bool {
+	options = append([]repr.Option{repr.Indent("  ")}, options...)
+	return func(t TestingT, expected, actual any, msgAndArgs ...any) bool {
+		if h, ok := t.(interface{ Helper() }); ok {
+			h.Helper()
+		}
+		if objectsAreEqual(expected, actual) {
+			return true
+		}
+		msg := fmt.Sprintf("Not equal:\nexpected: %s\nactual  : %s",
+			repr.IndentBy(repr.String(expected, options...), "          "),
+			repr.IndentBy(repr.String(actual, options...), "          "))
+		if extra := messageFromMsgAndArgs(msgAndArgs...); extra != "" {
+			msg += "\nMessages: " + extra
+		}
+		t.Errorf("%s", msg)
+		return false
+	}
+}
+
+// Mirrors testify's ObjectsAreEqual.
+func objectsAreEqual(expected, actual any) bool {
+	if expected == nil || actual == nil {
+		return expected == actual
+	}
+	exp, ok := expected.([]byte)
+	if !ok {
+		return reflect.DeepEqual(expected, actual)
+	}
+	act, ok := actual.([]byte)
+	if !ok {
+		return false
+	}
+	if exp == nil || act == nil {
+		return exp == nil && act == nil
+	}
+	return bytes.Equal(exp, act)
+}
+
+// Mirrors testify's handling of msgAndArgs: a single value is printed as is, otherwise the first
+// value is a format string for the rest.
+func messageFromMsgAndArgs(msgAndArgs ...any) string {
+	switch {
+	case len(msgAndArgs) == 0:
+		return ""
+	case len(msgAndArgs) == 1:
+		if msg, ok := msgAndArgs[0].(string); ok {
+			return msg
+		}
+		return fmt.Sprintf("%+v", msgAndArgs[0])
+	default:
+		if format, ok := msgAndArgs[0].(string); ok {
+			return fmt.Sprintf(format, msgAndArgs[1:]...)
+		}
+		return fmt.Sprint(msgAndArgs...)
+	}
+}
@@ -0,0 +1,4 @@
+// Package testifytest checks that the assertions in reprtest work with testify.
+//
+// It lives in its own module so that repr itself does not depend on testify.
+package testifytest
@@ -0,0 +1,14 @@
+module github.com/alecthomas/repr/reprtest/testifytest
+
+go 1.18
+
+require (
+	github.com/alecthomas/repr v0.0.0-20261015140834-5516c75cd376
+	github.com/stretchr/testify v1.8.1
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -0,0 +1,43 @@
+package testifytest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alecthomas/repr/reprtest"
+)
+
+// Any assert.TestingT is a reprtest.TestingT.
+var _ reprtest.TestingT = assert.TestingT(nil)
+
+// Equal can be wrapped as an assert.ComparisonAssertionFunc, as documented.
+var _ assert.ComparisonAssertionFunc = func(t assert.TestingT, expected, actual any, msgAndArgs ...any) bool {
+	return reprtest.Equal(t, expected, actual, msgAndArgs...)
+}
+
+type recorder struct{ failed bool }
+
+func (r *recorder) Errorf(format string, args ...any) { r.failed = true }
+
+func TestEqualMatchesTestify(t *testing.T) {
+	type pair struct{ A, B int }
+	for _, test := range []struct {
+		expected, actual any
+	}{
+		{1, 1},
+		{1, int64(1)},
+		{nil, nil},
+		{nil, (*int)(nil)},
+		{[]byte{}, []byte(nil)},
+		{[]byte("a"), []byte("a")},
+		{pair{1, 2}, pair{1, 2}},
+		{&pair{1, 2}, &pair{1, 2}},
+		{map[string]int{"a": 1}, map[string]int{"a": 2}},
+	} {
+		mine, theirs := &recorder{}, &recorder{}
+		if reprtest.Equal(mine, test.expected, test.actual) != assert.Equal(theirs, test.expected, test.actual) || mine.failed != theirs.failed {
+			t.Errorf("%#v and %#v: reprtest.Equal and assert.Equal disagree", test.expected, test.actual)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package reprtest
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/alecthomas/repr"
+)
+
+var (
+	importLock sync.Mutex
+	// Packages are type-checked from source, so share the importer, which caches them, between calls.
+	sourceImporter = importer.ForCompiler(token.NewFileSet(), "source", nil).(types.ImporterFrom)
+)
+
+// Type-checks the Go file that repr.GoFile generates for v, returning a description of any type error,
+// or of the type of the rebuilt value if it differs from the type of v.
+//
+// ok is false if the file could not be type-checked because it refers to identifiers that can't be
+// loaded from their packages, such as unexported types or types declared in test files.
+func typeCheck(v any, options ...repr.Option) (problem string, ok bool) {
+	if v == nil {
+		return "", false
+	}
+	source, err := repr.GoFile("roundtrip", "v", v, options...)
+	if err != nil {
+		return err.Error(), true
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "roundtrip.go", source, 0)
+	if err != nil {
+		return "invalid Go source: " + err.Error(), true
+	}
+	importLock.Lock()
+	defer importLock.Unlock()
+	if !resolvable(file) {
+		return "", false
+	}
+	conf := types.Config{Importer: sourceImporter}
+	pkg, err := conf.Check("roundtrip", fset, []*ast.File{file}, nil)
+	if err != nil {
+		return "type error: " + err.Error(), true
+	}
+	if have := pkg.Scope().Lookup("v").Type(); !sameType(have, reflect.TypeOf(v)) {
+		return fmt.Sprintf("rebuilt value has type %s, not %s", have, reflect.TypeOf(v)), true
+	}
+	return "", true
+}
+
+// Reports whether every package imported by file can be loaded, and every identifier that file
+// refers to in those packages is exported.
+func resolvable(file *ast.File) bool {
+	pkgs := map[string]*types.Package{}
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		pkg, err := sourceImporter.ImportFrom(path, ".", 0)
+		if err != nil {
+			return false
+		}
+		name := pkg.Name()
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		pkgs[name] = pkg
+	}
+	ok := true
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, isSel := n.(*ast.SelectorExpr); isSel {
+			if ident, isIdent := sel.X.(*ast.Ident); isIdent && pkgs[ident.Name] != nil {
+				if obj := pkgs[ident.Name].Scope().Lookup(sel.Sel.Name); obj == nil || !obj.Exported() {
+					ok = false
+				}
+			}
+		}
+		return ok
+	})
+	return ok
+}
+
+// Reports whether have, the type of a rebuilt value, is the type rt.
+func sameType(have types.Type, rt reflect.Type) bool {
+	if rt.Name() != "" {
+		if rt.PkgPath() == "" {
+			// Predeclared types, of which byte and rune are aliases.
+			name := map[string]string{"byte": "uint8", "rune": "int32"}[have.String()]
+			if name == "" {
+				name = have.String()
+			}
+			return name == rt.Name()
+		}
+		named, ok := have.(*types.Named)
+		// Type arguments are not compared, as reflect only has them as part of the name.
+		return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == rt.PkgPath() &&
+			named.Obj().Name() == strings.SplitN(rt.Name(), "[", 2)[0]
+	}
+	switch rt.Kind() {
+	case reflect.Ptr:
+		t, ok := have.(*types.Pointer)
+		return ok && sameType(t.Elem(), rt.Elem())
+	case reflect.Slice:
+		t, ok := have.(*types.Slice)
+		return ok && sameType(t.Elem(), rt.Elem())
+	case reflect.Array:
+		t, ok := have.(*types.Array)
+		return ok && t.Len() == int64(rt.Len()) && sameType(t.Elem(), rt.Elem())
+	case reflect.Map:
+		t, ok := have.(*types.Map)
+		return ok && sameType(t.Key(), rt.Key()) && sameType(t.Elem(), rt.Elem())
+	case reflect.Chan:
+		t, ok := have.(*types.Chan)
+		dirs := map[types.ChanDir]reflect.ChanDir{types.SendRecv: reflect.BothDir, types.SendOnly: reflect.SendDir, types.RecvOnly: reflect.RecvDir}
+		return ok && dirs[t.Dir()] == rt.ChanDir() && sameType(t.Elem(), rt.Elem())
+	case reflect.Struct:
+		t, ok := have.(*types.Struct)
+		if !ok || t.NumFields() != rt.NumField() {
+			return false
+		}
+		for i := 0; i < rt.NumField(); i++ {
+			f, rf := t.Field(i), rt.Field(i)
+			if f.Name() != rf.Name || f.Embedded() != rf.Anonymous || t.Tag(i) != string(rf.Tag) || !sameType(f.Type(), rf.Type) {
+				return false
+			}
+		}
+		return true
+	case reflect.Func:
+		t, ok := have.(*types.Signature)
+		if !ok || t.Params().Len() != rt.NumIn() || t.Results().Len() != rt.NumOut() || t.Variadic() != rt.IsVariadic() {
+			return false
+		}
+		for i := 0; i < rt.NumIn(); i++ {
+			if !sameType(t.Params().At(i).Type(), rt.In(i)) {
+				return false
+			}
+		}
+		for i := 0; i < rt.NumOut(); i++ {
+			if !sameType(t.Results().At(i).Type(), rt.Out(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Interface:
+		t, ok := have.Underlying().(*types.Interface)
+		if !ok || t.NumMethods() != rt.NumMethod() {
+			return false
+		}
+		for i := 0; i < rt.NumMethod(); i++ {
+			if t.Method(i).Name() != rt.Method(i).Name {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
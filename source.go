@@ -0,0 +1,115 @@
+package repr
+
+import (
+	"bytes"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// TypeSource follows top-level values with the definitions of the named types they contain, as
+// comments. Definitions are read from the source of the types' packages, so are only included for
+// packages whose source is available, excluding the standard library.
+func TypeSource() Option { return func(o *Printer) { o.typeSource = true } }
+
+// Named types encountered while printing a value, in the order they were encountered.
+type typeSet struct {
+	seen  map[reflect.Type]bool
+	types []reflect.Type
+}
+
+func (s *typeSet) add(t reflect.Type) {
+	for t.Name() == "" && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map) {
+		t = t.Elem()
+	}
+	if t.Name() == "" || t.PkgPath() == "" || s.seen[t] {
+		return
+	}
+	s.seen[t] = true
+	s.types = append(s.types, t)
+}
+
+// Writes the definition of each type as comments.
+func (p *Printer) writeTypeSources(types []reflect.Type) {
+	for _, t := range types {
+		source, ok := typeDefinition(t)
+		if !ok {
+			continue
+		}
+		p.w.Write([]byte("\n")) // nolint: errcheck
+		for _, line := range strings.Split(source, "\n") {
+			p.writeToken(commentToken, strings.TrimRight("// "+line, " "))
+			p.w.Write([]byte("\n")) // nolint: errcheck
+		}
+	}
+}
+
+type parsedPackage struct {
+	fset  *token.FileSet
+	specs map[string]*ast.GenDecl // Declarations of package level types by name.
+}
+
+var (
+	parsedPackagesLock sync.Mutex
+	parsedPackages     = map[string]*parsedPackage{}
+)
+
+// Returns the source of the declaration of named type t.
+func typeDefinition(t reflect.Type) (string, bool) {
+	pkg := parsePackage(t.PkgPath())
+	if pkg == nil {
+		return "", false
+	}
+	name := strings.SplitN(t.Name(), "[", 2)[0]
+	decl, ok := pkg.specs[name]
+	if !ok {
+		return "", false
+	}
+	w := &bytes.Buffer{}
+	if err := format.Node(w, pkg.fset, decl); err != nil {
+		return "", false
+	}
+	return w.String(), true
+}
+
+// Parses the type declarations of the package with the given import path, returning nil if its source
+// is not available.
+func parsePackage(path string) *parsedPackage {
+	parsedPackagesLock.Lock()
+	defer parsedPackagesLock.Unlock()
+	if pkg, ok := parsedPackages[path]; ok {
+		return pkg
+	}
+	parsedPackages[path] = nil
+	bpkg, err := build.Import(path, ".", 0)
+	if err != nil || bpkg.Goroot {
+		return nil
+	}
+	pkg := &parsedPackage{fset: token.NewFileSet(), specs: map[string]*ast.GenDecl{}}
+	files := append(append([]string{}, bpkg.GoFiles...), bpkg.TestGoFiles...)
+	for _, file := range files {
+		f, err := parser.ParseFile(pkg.fset, filepath.Join(bpkg.Dir, file), nil, parser.ParseComments)
+		if err != nil {
+			continue
+		}
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				// Print each type on its own, even if declared in a group.
+				pkg.specs[ts.Name.Name] = &ast.GenDecl{Tok: token.TYPE, Specs: []ast.Spec{ts}}
+			}
+		}
+	}
+	parsedPackages[path] = pkg
+	return pkg
+}
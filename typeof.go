@@ -0,0 +1,130 @@
+package repr
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// TypeOf returns the shape of the types in v, without any values.
+//
+// Structs are expanded to show the shape of each field, and slices, arrays and maps show the distinct
+// shapes of their elements. Dynamic types are used for values stored in interfaces, so decoded data
+// such as map[string]any trees show the type of each value, eg.
+//
+//	map[string]any{"name": string, "tags": []any{string}}
+func TypeOf(v any, options ...Option) string {
+	options = append([]Option{NoIndent()}, options...)
+	p := New(nil, options...)
+	return p.shapeOf(map[reflect.Value]bool{}, reflect.ValueOf(v), "")
+}
+
+func (p *Printer) shapeOf(seen map[reflect.Value]bool, v reflect.Value, indent string) string {
+	if v.Kind() == reflect.Invalid {
+		return "nil"
+	}
+	if seen[v] {
+		return "..."
+	}
+	seen[v] = true
+	defer delete(seen, v)
+
+	t := v.Type()
+	v = accessible(v)
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return substAny(t)
+		}
+		return p.shapeOf(seen, v.Elem(), indent)
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			return substAny(t)
+		}
+		return "*" + p.shapeOf(seen, v.Elem(), indent)
+
+	case reflect.Struct:
+		// Values represented by a single expression, such as time.Time, have no shape of their own.
+		if p.isOpaque(v) {
+			return substAny(t)
+		}
+		fields := []string{}
+		plan := planOf(t)
+		for i := 0; i < v.NumField(); i++ {
+			ft := &plan.fields[i]
+			if p.hideField(ft, v.Field(i)) {
+				continue
+			}
+			fields = append(fields, p.fieldName(ft)+": "+p.shapeOf(seen, v.Field(i), p.nextIndent(indent)))
+		}
+		return substAny(t) + p.shapeBlock(fields, indent)
+
+	case reflect.Slice, reflect.Array:
+		if t == byteSliceType {
+			return substAny(t)
+		}
+		shapes := []string{}
+		distinct := map[string]bool{}
+		for i := 0; i < v.Len(); i++ {
+			shape := p.shapeOf(seen, v.Index(i), p.nextIndent(indent))
+			if !distinct[shape] {
+				distinct[shape] = true
+				shapes = append(shapes, shape)
+			}
+		}
+		if len(shapes) == 0 || (len(shapes) == 1 && shapes[0] == substAny(t.Elem())) {
+			return substAny(t)
+		}
+		return substAny(t) + p.shapeBlock(shapes, indent)
+
+	case reflect.Map:
+		keys := v.MapKeys()
+		p.sortMapKeys(seen, keys)
+		shapes := []string{}
+		entries := []string{}
+		distinct := map[string]bool{}
+		for _, k := range keys {
+			kv := v.MapIndex(k)
+			if !kv.IsValid() {
+				// Deleted while the map was being inspected.
+				continue
+			}
+			shape := p.shapeOf(seen, kv, p.nextIndent(indent))
+			if !distinct[shape] {
+				distinct[shape] = true
+				shapes = append(shapes, shape)
+			}
+			entries = append(entries, p.flatString(seen, k)+": "+shape)
+		}
+		// Entries of maps with interface values are listed individually, as they're typically decoded data.
+		switch {
+		case t.Elem().Kind() == reflect.Interface:
+			return substAny(t) + p.shapeBlock(entries, indent)
+		case len(shapes) == 0 || (len(shapes) == 1 && shapes[0] == substAny(t.Elem())):
+			return substAny(t)
+		case len(shapes) == 1:
+			return substAny(t) + p.shapeBlock(shapes, indent)
+		}
+		return substAny(t) + p.shapeBlock(entries, indent)
+	}
+	return substAny(t)
+}
+
+// Formats the elements of a composite shape, one per line if indenting.
+func (p *Printer) shapeBlock(elements []string, indent string) string {
+	if len(elements) == 0 {
+		return "{}"
+	}
+	if p.indent == "" {
+		return "{" + strings.Join(elements, ", ") + "}"
+	}
+	ni := p.nextIndent(indent)
+	w := &strings.Builder{}
+	fmt.Fprint(w, "{\n")
+	for _, element := range elements {
+		fmt.Fprintf(w, "%s%s,\n", ni, element)
+	}
+	fmt.Fprintf(w, "%s}", indent)
+	return w.String()
+}
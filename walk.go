@@ -0,0 +1,95 @@
+package repr
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// Walk calls fn for v and, depth first, every value reachable from it, with the path to each value
+// in the same form as UnrepresentableError, eg. `Field[0]["key"]`.
+//
+// As when printing, unexported fields are made accessible, map keys are visited in sorted order and
+// cycles are not followed. Pointers and interfaces are visited at the same path as their elements.
+//
+// If fn returns false the values reachable from v are skipped.
+func Walk(v any, fn func(path string, v reflect.Value) bool) {
+	w := &walker{fn: fn, seen: map[reflect.Value]bool{}, p: New(io.Discard)}
+	w.walk("", reflect.ValueOf(v))
+}
+
+type walker struct {
+	fn   func(path string, v reflect.Value) bool
+	seen map[reflect.Value]bool
+	p    *Printer // Formats map keys in paths as Flatten does.
+}
+
+func (w *walker) walk(path string, v reflect.Value) {
+	if !v.IsValid() || w.seen[v] {
+		return
+	}
+	w.seen[v] = true
+	defer delete(w.seen, v)
+	v = accessible(v)
+	if !w.fn(displayPath(path), v) {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			w.walk(path, v.Elem())
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			w.walk(fmt.Sprintf("%s[%d]", path, i), v.Index(i))
+		}
+
+	case reflect.Map:
+		keys := v.MapKeys()
+		names := make([]string, len(keys))
+		for i, k := range keys {
+			names[i] = w.p.flatKey(w.seen, k)
+		}
+		sort.Sort(keysByString{keys: keys, strings: names})
+		for i, k := range keys {
+			w.walk(path+"["+names[i]+"]", v.MapIndex(k))
+		}
+
+	case reflect.Struct:
+		if !v.CanAddr() {
+			// Fields of unaddressable structs can't be accessed via unsafe, so copy it first.
+			src := reflect.New(v.Type()).Elem()
+			src.Set(v)
+			v = src
+		}
+		for i := 0; i < v.NumField(); i++ {
+			w.walk(path+"."+v.Type().Field(i).Name, v.Field(i))
+		}
+	}
+}
+
+// Match is a value found by Find.
+type Match struct {
+	// Path to the value, as passed to the predicate.
+	Path  string
+	Value reflect.Value
+	// Repr is the representation of the value on a single line.
+	Repr string
+}
+
+// Find returns every value reachable from v, in the order visited by Walk, for which pred returns true.
+//
+// Options control the rendering of each match.
+func Find(v any, pred func(path string, v reflect.Value) bool, options ...Option) []Match {
+	p := New(nil, append([]Option{NoIndent()}, options...)...)
+	var matches []Match
+	Walk(v, func(path string, v reflect.Value) bool {
+		if pred(path, v) {
+			matches = append(matches, Match{Path: path, Value: v, Repr: p.flatString(map[reflect.Value]bool{}, v)})
+		}
+		return true
+	})
+	return matches
+}